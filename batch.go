@@ -0,0 +1,192 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+)
+
+// file listing the batches of a payout
+const batchManifestFile = "batches.json"
+
+// Flags
+var (
+	batchDir  string
+	batchSize int
+	batchGas  uint64
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().StringVar(&batchDir, "batch-dir", "",
+		"directory to write the multisend input split into batches, with a manifest")
+	PayoutCmd.PersistentFlags().IntVar(&batchSize, "batch-size", 100,
+		"maximum number of recipients of a batch, unlimited if 0")
+	PayoutCmd.PersistentFlags().Uint64Var(&batchGas, "batch-gas", 0,
+		"maximum estimated gas of a batch, unlimited if 0")
+}
+
+// A batch of the multisend input
+type BatchInfo struct {
+	File       string `json:"file"`
+	Recipients int    `json:"recipients"`
+	// total amount in IOTX
+	Total  string `json:"total"`
+	Gas    uint64 `json:"gas"`
+	SHA256 string `json:"sha256"`
+}
+
+// Batches of a payout
+type BatchManifest struct {
+	Version    string      `json:"version"`
+	Recipients int         `json:"recipients"`
+	Total      string      `json:"total"`
+	Batches    []BatchInfo `json:"batches"`
+	// completed epochs paid out, appended to the record file by reconcile
+	// once every batch is paid
+	Records []PayoutRecord `json:"records,omitempty"`
+}
+
+// estimated gas of a multisend to n recipients
+func multisendGas(n int) uint64 {
+	return multisendGasBase + gasPerRecipient*uint64(n)
+}
+
+// split the multisend input into batches of at most maxRecipients
+// recipients and maxGas estimated gas, 0 for unlimited
+func splitMultisend(rewards []MultisendReward, maxRecipients int, maxGas uint64) ([][]MultisendReward, error) {
+	if maxGas > 0 && multisendGas(1) > maxGas {
+		return nil, fmt.Errorf("a single recipient needs %d gas, above the batch limit %d",
+			multisendGas(1), maxGas)
+	}
+	var batches [][]MultisendReward
+	var batch []MultisendReward
+	for _, r := range rewards {
+		full := maxRecipients > 0 && len(batch) >= maxRecipients ||
+			maxGas > 0 && multisendGas(len(batch)+1) > maxGas
+		if full {
+			batches = append(batches, batch)
+			batch = nil
+		}
+		batch = append(batch, r)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// write the multisend input as numbered batch files and their manifest. The
+// batch files of a previous payout in dir are removed, so that none of them
+// is mistaken for a batch of this one.
+func writeBatches(dir string, sent string, records []PayoutRecord) (*BatchManifest, error) {
+	var rewards []MultisendReward
+	if err := json.Unmarshal([]byte(sent), &rewards); err != nil {
+		return nil, fmt.Errorf("invalid multisend input: %v", err)
+	}
+	batches, err := splitMultisend(rewards, batchSize, batchGas)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "batch-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range stale {
+		if err := os.Remove(file); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &BatchManifest{Version: version, Records: records}
+	for i, batch := range batches {
+		data, _ := json.Marshal(batch)
+		total, n, err := multisendTotal(string(data))
+		if err != nil {
+			return nil, err
+		}
+		info := BatchInfo{
+			File:       fmt.Sprintf("batch-%03d.json", i+1),
+			Recipients: n,
+			Total:      util.RauToString(total, util.IotxDecimalNum),
+			Gas:        multisendGas(n),
+			SHA256:     sha256Hex(data),
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, info.File), data, 0644); err != nil {
+			return nil, err
+		}
+		m.Batches = append(m.Batches, info)
+	}
+	total, n, err := multisendTotal(sent)
+	if err != nil {
+		return nil, err
+	}
+	m.Recipients = n
+	m.Total = util.RauToString(total, util.IotxDecimalNum)
+
+	data, _ := json.MarshalIndent(m, "", "    ")
+	if err := ioutil.WriteFile(filepath.Join(dir, batchManifestFile), data, 0644); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// write the batches to dir, --batch-dir or a directory under it, with the
+// records of the payout. Does nothing without --batch-dir.
+func saveBatches(dir string, sent string, records []PayoutRecord) {
+	if batchDir == "" {
+		if recordFile != "" {
+			fmt.Println("epochs are recorded by reconcile once paid, which needs --batch-dir")
+		}
+		return
+	}
+	m, err := writeBatches(dir, sent, records)
+	if err != nil {
+		panic(err)
+	}
+	for _, b := range m.Batches {
+		fmt.Printf("%s: %d recipients, %s IOTX\n", b.File, b.Recipients, b.Total)
+	}
+}
+
+// read the manifest of a batch directory, checking the batch files
+func loadBatchManifest(dir string) (*BatchManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, batchManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var m BatchManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid batch manifest: %v", err)
+	}
+	for _, b := range m.Batches {
+		data, err := ioutil.ReadFile(filepath.Join(dir, b.File))
+		if err != nil {
+			return nil, err
+		}
+		if sha256Hex(data) != b.SHA256 {
+			return nil, fmt.Errorf("%s: SHA-256 does not match the manifest", b.File)
+		}
+	}
+	return &m, nil
+}
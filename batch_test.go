@@ -0,0 +1,116 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func testMultisend(n int) []MultisendReward {
+	var rewards []MultisendReward
+	for i := 0; i < n; i++ {
+		rewards = append(rewards, MultisendReward{"0x0" + strconv.Itoa(i), strconv.Itoa(i + 1)})
+	}
+	return rewards
+}
+
+func TestSplitMultisend(t *testing.T) {
+	tests := []struct {
+		recipients    int
+		maxRecipients int
+		maxGas        uint64
+		expected      []int
+	}{
+		{5, 0, 0, []int{5}},
+		{5, 2, 0, []int{2, 2, 1}},
+		// 50000 + 2 * 30000 gas fits 2 recipients
+		{5, 0, 110000, []int{2, 2, 1}},
+		{5, 1, 110000, []int{1, 1, 1, 1, 1}},
+		{0, 2, 0, nil},
+	}
+	for _, test := range tests {
+		batches, err := splitMultisend(testMultisend(test.recipients), test.maxRecipients, test.maxGas)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sizes []int
+		for _, b := range batches {
+			sizes = append(sizes, len(b))
+		}
+		if len(sizes) != len(test.expected) {
+			t.Errorf("Expect batches %v, get %v", test.expected, sizes)
+			continue
+		}
+		for i := range sizes {
+			if sizes[i] != test.expected[i] {
+				t.Errorf("Expect batches %v, get %v", test.expected, sizes)
+				break
+			}
+		}
+	}
+
+	if _, err := splitMultisend(testMultisend(1), 0, 10000); err == nil {
+		t.Error("Expect error on gas limit below a single recipient")
+	}
+}
+
+func TestWriteBatches(t *testing.T) {
+	batchSizeOrig := batchSize
+	defer func() { batchSize = batchSizeOrig }()
+	batchSize = 2
+
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sent, _ := json.Marshal(testMultisend(3))
+	m, err := writeBatches(dir, string(sent), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Recipients != 3 || m.Total != "6" || len(m.Batches) != 2 {
+		t.Fatalf("Expect 6 IOTX to 3 recipients in 2 batches, get %+v", m)
+	}
+	if m.Batches[0].Total != "3" || m.Batches[1].File != "batch-002.json" {
+		t.Errorf("Unexpected batches %+v", m.Batches)
+	}
+
+	if _, err := loadBatchManifest(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "batch-001.json")
+	if err := ioutil.WriteFile(path, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBatchManifest(dir); err == nil {
+		t.Error("Expect error on modified batch")
+	}
+
+	// the batches of the previous payout are removed
+	sent, _ = json.Marshal(testMultisend(1))
+	if _, err := writeBatches(dir, string(sent), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "batch-002.json")); !os.IsNotExist(err) {
+		t.Errorf("Expect stale batch-002.json removed, get %v", err)
+	}
+}
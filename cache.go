@@ -0,0 +1,153 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// how long the current epoch number is trusted before asking the chain again
+const currentEpochTTL = time.Minute
+
+// number of epoch metas and election results kept in memory
+const chainDataCacheSize = 100
+
+// Bounded cache, the oldest entry is evicted first.
+// A nil cache is valid and caches nothing.
+type memo struct {
+	mu      sync.Mutex
+	size    int
+	keys    []string
+	entries map[string]interface{}
+}
+
+func newMemo(size int) *memo {
+	return &memo{
+		size:    size,
+		entries: make(map[string]interface{}),
+	}
+}
+
+func (m *memo) get(key interface{}) interface{} {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[fmt.Sprint(key)]
+}
+
+func (m *memo) put(key interface{}, value interface{}) {
+	if m == nil || m.size <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := fmt.Sprint(key)
+	if _, ok := m.entries[k]; ok {
+		return
+	}
+	if len(m.keys) >= m.size {
+		delete(m.entries, m.keys[0])
+		m.keys = m.keys[1:]
+	}
+	m.keys = append(m.keys, k)
+	m.entries[k] = value
+}
+
+// chain data shared by all delegates and epochs
+var (
+	// epoch metas of completed epochs, keyed by epoch number
+	epochMetas = newMemo(chainDataCacheSize)
+	// vote snapshots, keyed by gravity chain height
+	voteSnapshots = newMemo(chainDataCacheSize)
+	// whether chain data can only come from the caches, when replaying
+	offline bool
+)
+
+var (
+	latestMu        sync.Mutex
+	latestEpochNum  uint64
+	latestCheckedAt time.Time
+)
+
+// current epoch number, refreshed at most once per currentEpochTTL. The lock
+// is not held while fetching it, so that a slow call does not block others.
+func latestEpoch(ctx context.Context) uint64 {
+	latestMu.Lock()
+	num, fresh := latestEpochNum, time.Since(latestCheckedAt) <= currentEpochTTL
+	latestMu.Unlock()
+	if fresh {
+		return num
+	}
+	num = currentEpochNum(ctx)
+	latestMu.Lock()
+	latestEpochNum, latestCheckedAt = num, time.Now()
+	latestMu.Unlock()
+	return num
+}
+
+// Cache of single-epoch reward shares.
+//
+// Only completed epochs are cached, since the productivity of the current
+// epoch still changes. A nil cache is valid and caches nothing.
+type rewardSharesCache struct {
+	entries *memo
+}
+
+// cache used by calculateRewardShares, disabled by default
+var epochCache *rewardSharesCache
+
+// Allocate a cache holding up to size epochs
+func newRewardSharesCache(size int) *rewardSharesCache {
+	return &rewardSharesCache{newMemo(size)}
+}
+
+func cacheKey(operator string, delegate []byte, epoch uint64, comm Commission) string {
+	return fmt.Sprintf("%s/%x/%d/%v", operator, delegate, epoch, comm)
+}
+
+// Get cached reward shares of an epoch, nil if missing
+func (c *rewardSharesCache) get(operator string, delegate []byte, epoch uint64, comm Commission) *RewardShares {
+	if c == nil {
+		return nil
+	}
+	if v := c.entries.get(cacheKey(operator, delegate, epoch, comm)); v != nil {
+		return v.(*RewardShares)
+	}
+	return nil
+}
+
+// Cache reward shares of an epoch if the epoch is completed
+func (c *rewardSharesCache) put(ctx context.Context, operator string, delegate []byte, epoch uint64, comm Commission, rs *RewardShares) {
+	if c == nil || epoch >= latestEpoch(ctx) {
+		return
+	}
+	c.entries.put(cacheKey(operator, delegate, epoch, comm), rs.Clone())
+}
+
+// populate reward shares for a single epoch, through the cache if enabled.
+// The returned rewardshares can be modified by the caller.
+func cachedEpochRewardShares(ctx context.Context, operator string, delegate []byte, epoch uint64, comm Commission) *RewardShares {
+	if rs := epochCache.get(operator, delegate, epoch, comm); rs != nil {
+		return rs.Clone()
+	}
+	rs := calculateEpochRewardShares(ctx, operator, delegate, epoch, comm)
+	epochCache.put(ctx, operator, delegate, epoch, comm, rs)
+	return rs
+}
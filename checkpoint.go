@@ -0,0 +1,161 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Files of a checkpoint directory
+//   config.json          the delegates, epochs and settings of the run
+//   DELEGATE/N.json      reward shares of epoch N of a delegate, by hex name
+const checkpointConfigFile = "config.json"
+
+// Flags
+var (
+	checkpointDir string
+	resume        bool
+)
+
+func init() {
+	PayoutCmd.Flags().StringVar(&checkpointDir, "checkpoint-dir", "",
+		"directory to save the reward shares of each completed epoch to, so that the run can be resumed")
+	PayoutCmd.Flags().BoolVar(&resume, "resume", false,
+		"resume the run checkpointed in --checkpoint-dir, calculating only the epochs missing")
+}
+
+// Reward shares of the completed epochs of a run. A nil store keeps nothing.
+type checkpointStore struct {
+	dir string
+}
+
+// checkpoints of the current run, nil if not checkpointing
+var checkpoints *checkpointStore
+
+// read the config of the run checkpointed in dir
+func loadCheckpointConfig(dir string) ([]byte, *SnapshotConfig, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointConfigFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	var config SnapshotConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, fmt.Errorf("invalid checkpoint config in %s: %v", dir, err)
+	}
+	return data, &config, nil
+}
+
+// label and numbers of the epochs to pay out, those of the checkpointed run
+// when resuming one
+func runEpochs(epochs string, delegates ...[]byte) (string, []uint64) {
+	if resume && checkpointDir != "" {
+		if _, config, err := loadCheckpointConfig(checkpointDir); err == nil {
+			return config.Epochs, config.EpochNums
+		}
+	}
+	epochNums := epochList(context.Background(), epochs, delegates...)
+	return epochLabel(epochs, epochNums), epochNums
+}
+
+// Open the checkpoints of a run in dir, nil if dir is empty. Without resume
+// dir must not hold checkpoints of a previous run, and with resume those
+// must be of a run with the same config.
+func openCheckpoints(dir string, resume bool, config SnapshotConfig) (*checkpointStore, error) {
+	if dir == "" {
+		if resume {
+			return nil, errors.New("--resume needs the --checkpoint-dir of the run")
+		}
+		return nil, nil
+	}
+	if resume && snapshotDir != "" {
+		return nil, errors.New("a resumed run cannot be snapshotted, the chain data of checkpointed epochs is missing")
+	}
+	data, _ := json.MarshalIndent(config, "", "    ")
+	saved, _, err := loadCheckpointConfig(dir)
+	switch {
+	case os.IsNotExist(err):
+		if resume {
+			fmt.Printf("no checkpoint in %s, starting from the first epoch\n", dir)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, checkpointConfigFile), data); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !resume:
+		return nil, fmt.Errorf("%s holds the checkpoints of a previous run, resume it with --resume or use another directory", dir)
+	case !bytes.Equal(saved, data):
+		return nil, fmt.Errorf("checkpoints in %s are of another run, the delegates or settings differ", dir)
+	}
+	return &checkpointStore{dir}, nil
+}
+
+func (c *checkpointStore) path(delegate []byte, epoch uint64) string {
+	return filepath.Join(c.dir, hex.EncodeToString(delegate), strconv.FormatUint(epoch, 10)+".json")
+}
+
+// reward shares of an epoch of a delegate, nil if not checkpointed
+func (c *checkpointStore) load(delegate []byte, epoch uint64) (*RewardShares, error) {
+	if c == nil {
+		return nil, nil
+	}
+	rs, err := loadRewardShares(c.path(delegate, epoch))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return rs, err
+}
+
+// checkpoint the reward shares of an epoch of a delegate if it is completed
+func (c *checkpointStore) save(ctx context.Context, delegate []byte, epoch uint64, rs *RewardShares) error {
+	if c == nil || epoch >= latestEpoch(ctx) {
+		return nil
+	}
+	path := c.path(delegate, epoch)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, []byte(rs.String()))
+}
+
+// populate reward shares for a single epoch from its checkpoint, or calculate
+// and checkpoint them
+func checkpointedEpochRewardShares(ctx context.Context, operator string, delegate []byte, epoch uint64, comm Commission) *RewardShares {
+	rs, err := checkpoints.load(delegate, epoch)
+	if err != nil {
+		panic(err)
+	}
+	if rs != nil {
+		fmt.Printf("epoch %v: from checkpoint\n", epoch)
+		return rs
+	}
+	rs = cachedEpochRewardShares(ctx, operator, delegate, epoch, comm)
+	if err := checkpoints.save(ctx, delegate, epoch, rs); err != nil {
+		panic(err)
+	}
+	return rs
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	checkpointsDir := filepath.Join(dir, "checkpoints")
+
+	defer func(epochs string, output string, cpDir string, res bool, block, foundation, epoch int64) {
+		epochToQuery, outputFile, checkpointDir, resume = epochs, output, cpDir, res
+		blockComm, foundationComm, epochComm = block, foundation, epoch
+		checkpoints = nil
+	}(epochToQuery, outputFile, checkpointDir, resume, blockComm, foundationComm, epochComm)
+
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100), testVoteSnapshot(7500200)})
+	PayoutCmd.SetArgs([]string{"delegate1", "-e", "last:2", "-b", "10", "-f", "10", "-p", "10",
+		"-o", filepath.Join(dir, "full.json"), "--checkpoint-dir", checkpointsDir})
+	err = PayoutCmd.Execute()
+	stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the run was interrupted after epoch 10
+	delegateDir := filepath.Join(checkpointsDir, hex.EncodeToString(delegateName("delegate1")))
+	if _, err := os.Stat(filepath.Join(delegateDir, "10.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(delegateDir, "11.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// epoch 10 is not available anymore, and last:2 would now be 11-12
+	s := testAPIServer()
+	s.current = 13
+	s.epochs[13] = testEpochMeta(13, 7500300)
+	delete(s.epochs, 10)
+	stop = startFakeAPIServer(t, s, []*VoteSnapshot{
+		testVoteSnapshot(7500100), testVoteSnapshot(7500300)})
+	defer stop()
+	PayoutCmd.SetArgs([]string{"delegate1", "-e", "last:2", "-b", "10", "-f", "10", "-p", "10",
+		"-o", filepath.Join(dir, "resumed.json"), "--checkpoint-dir", checkpointsDir, "--resume"})
+	if err := PayoutCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	full, err := ioutil.ReadFile(filepath.Join(dir, "full.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := ioutil.ReadFile(filepath.Join(dir, "resumed.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resumed) != string(full) {
+		t.Errorf("Expect the resumed run to output\n%s\nget\n%s", full, resumed)
+	}
+	if _, err := os.Stat(filepath.Join(delegateDir, "11.json")); err != nil {
+		t.Errorf("Expect epoch 11 to be checkpointed again, %v", err)
+	}
+}
+
+func TestOpenCheckpoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	comm := Commission{10, 10, 10}
+	config := newSnapshotConfig(
+		[]ManifestDelegate{{Name: "delegate1", Operator: testOperator, Commission: &comm}},
+		"10-11", []uint64{10, 11})
+	if c, err := openCheckpoints("", false, config); c != nil || err != nil {
+		t.Errorf("Expect no checkpoints without directory, get %v, %v", c, err)
+	}
+	if _, err := openCheckpoints("", true, config); err == nil {
+		t.Error("Expect error resuming without directory")
+	}
+	if _, err := openCheckpoints(dir, false, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCheckpoints(dir, false, config); err == nil {
+		t.Error("Expect error starting over a previous run without --resume")
+	}
+	if _, err := openCheckpoints(dir, true, config); err != nil {
+		t.Errorf("Expect the run to be resumed, get %v", err)
+	}
+	config.Delegates[0].Commission = &Commission{20, 20, 20}
+	if _, err := openCheckpoints(dir, true, config); err == nil {
+		t.Error("Expect error resuming a run with other settings")
+	}
+}
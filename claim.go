@@ -0,0 +1,182 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/iotexproject/iotex-core/action"
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/account"
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Flags
+var (
+	claimSigner     string
+	claimDryRun     bool
+	claimRecordFile string
+)
+
+var ClaimCmd = &cobra.Command{
+	Use:   "claim [AMOUNT_IOTX] --signer SIGNER",
+	Short: "Claims the reward of the signer's address from the rewarding protocol, all of it by default",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		amount := ""
+		if len(args) > 0 {
+			amount = args[0]
+		}
+		if err := claim(amount); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	// no shorthand, -s is the persistent --simple flag
+	ClaimCmd.Flags().StringVar(&claimSigner, "signer", "",
+		"alias or address of the reward address, whose key in the ioctl keystore signs the claim")
+	ClaimCmd.Flags().BoolVar(&claimDryRun, "dry-run", false,
+		"print the claim without sending it")
+	ClaimCmd.Flags().StringVar(&claimRecordFile, "claim-record", "iotex_payout.claims",
+		"file recording the amounts claimed")
+	ClaimCmd.Flags().StringVarP(&epochToQuery, "epoch", "e", "",
+		"epoch(s) the claimed reward was earned in, recorded along with the amount")
+
+	PayoutCmd.AddCommand(ClaimCmd)
+}
+
+// read the password of the signer's key without echoing it
+var readPassword = func() ([]byte, error) {
+	return terminal.ReadPassword(int(syscall.Stdin))
+}
+
+// Record of a claim, appended to the claim record file
+type ClaimRecord struct {
+	Address    string    `json:"address"`
+	Amount     string    `json:"amount"`
+	Epochs     string    `json:"epochs,omitempty"`
+	FirstEpoch uint64    `json:"firstepoch,omitempty"`
+	LastEpoch  uint64    `json:"lastepoch,omitempty"`
+	ActionHash string    `json:"actionhash"`
+	Time       time.Time `json:"time"`
+}
+
+// amount to claim in rau, all the unclaimed reward if empty
+func claimAmount(amount string, unclaimed *big.Int) (*big.Int, error) {
+	if amount == "" {
+		return unclaimed, nil
+	}
+	rau, err := util.StringToRau(amount, util.IotxDecimalNum)
+	if err != nil {
+		return nil, err
+	}
+	if rau.Cmp(unclaimed) > 0 {
+		return nil, fmt.Errorf("cannot claim %s IOTX, only %s IOTX unclaimed",
+			amount, util.RauToString(unclaimed, util.IotxDecimalNum))
+	}
+	return rau, nil
+}
+
+// claim reward of the signer's address from the rewarding protocol
+func claim(amount string) error {
+	if claimSigner == "" {
+		return fmt.Errorf("signer is required")
+	}
+	addr, err := alias.Address(claimSigner)
+	if err != nil {
+		return err
+	}
+	record := ClaimRecord{Address: addr, Epochs: epochToQuery}
+	if epochToQuery != "" {
+		epochs, err := resolveEpochs(context.Background(), epochToQuery)
+		if err != nil {
+			return err
+		}
+		record.FirstEpoch, record.LastEpoch = epochs[0], epochs[len(epochs)-1]
+	}
+
+	unclaimed := unclaimedReward(addr)
+	rau, err := claimAmount(amount, unclaimed)
+	if err != nil {
+		return err
+	}
+	if rau.Sign() == 0 {
+		fmt.Printf("%s has no reward to claim\n", addr)
+		return nil
+	}
+	record.Amount = rau.Text(10)
+
+	cli, err := session.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := apiContext(context.Background())
+	accountResponse, err := cli.GetAccount(ctx, &iotexapi.GetAccountRequest{Address: addr})
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	act := (&action.ClaimFromRewardingFundBuilder{}).SetAmount(rau).Build()
+	elp := (&action.EnvelopeBuilder{}).
+		SetNonce(accountResponse.GetAccountMeta().GetPendingNonce()).
+		SetGasPrice(suggestGasPrice()).
+		SetGasLimit(action.ClaimFromRewardingFundBaseGas).
+		SetAction(&act).Build()
+	fmt.Printf("claim %s IOTX of %s IOTX unclaimed by %s, nonce %d\n",
+		util.RauToString(rau, util.IotxDecimalNum),
+		util.RauToString(unclaimed, util.IotxDecimalNum), addr, elp.Nonce())
+	if claimDryRun {
+		return nil
+	}
+
+	fmt.Printf("Enter password #%s:\n", claimSigner)
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	prvKey, err := account.KsAccountToPrivateKey(claimSigner, string(password))
+	if err != nil {
+		return err
+	}
+	sealed, err := action.Sign(elp, prvKey)
+	prvKey.Zero()
+	if err != nil {
+		return err
+	}
+	ctx, cancel = apiContext(context.Background())
+	defer cancel()
+	if _, err := cli.SendAction(ctx, &iotexapi.SendActionRequest{Action: sealed.Proto()}); err != nil {
+		return err
+	}
+
+	h := sealed.Hash()
+	record.ActionHash = hex.EncodeToString(h[:])
+	record.Time = time.Now().UTC()
+	fmt.Printf("claim sent, action hash %s\n", record.ActionHash)
+	return appendRecord(claimRecordFile, record)
+}
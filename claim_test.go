@@ -0,0 +1,132 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/iotexproject/iotex-address/address"
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/config"
+)
+
+func TestClaimAmount(t *testing.T) {
+	unclaimed, _ := new(big.Int).SetString("12500000000000000000000", 10)
+
+	amount, err := claimAmount("", unclaimed)
+	if err != nil || amount.Cmp(unclaimed) != 0 {
+		t.Errorf("Expect all unclaimed reward by default, get %v %v", amount, err)
+	}
+	amount, err = claimAmount("100.5", unclaimed)
+	if err != nil || amount.Text(10) != "100500000000000000000" {
+		t.Errorf("Expect 100.5 IOTX in rau, get %v %v", amount, err)
+	}
+	if _, err := claimAmount("12500.1", unclaimed); err == nil {
+		t.Error("Expect error on claiming more than unclaimed")
+	}
+}
+
+// run f, returning what it printed to stdout
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	return string(out)
+}
+
+func TestClaimCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a signer with its key in a keystore of its own
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := address.FromBytes(acct.Address.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(wallet string) { config.ReadConfig.Wallet = wallet }(config.ReadConfig.Wallet)
+	config.ReadConfig.Wallet = dir
+	defer func(read func() ([]byte, error)) { readPassword = read }(readPassword)
+	readPassword = func() ([]byte, error) { return []byte("password"), nil }
+
+	s := testAPIServer()
+	s.unclaimed[signer.String()] = "150000000000000000000"
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+	defer func(signer string, dryRun bool, epochs string, record string) {
+		claimSigner, claimDryRun, epochToQuery, claimRecordFile = signer, dryRun, epochs, record
+	}(claimSigner, claimDryRun, epochToQuery, claimRecordFile)
+
+	out := captureStdout(t, func() {
+		PayoutCmd.SetArgs([]string{"claim", "100", "--signer", testRewardAddress, "--dry-run", "-e", "10-11"})
+		err = PayoutCmd.Execute()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "claim 100 IOTX of 150 IOTX unclaimed by " + testRewardAddress + ", nonce 0\n"
+	if out != expected {
+		t.Errorf("Expect %q, get %q", expected, out)
+	}
+	if len(s.sent) != 0 {
+		t.Fatalf("Expect nothing sent on a dry run, get %d actions", len(s.sent))
+	}
+
+	// the flag keeps its value from the previous run
+	claimDryRun = false
+	claimRecordFile = filepath.Join(dir, "claims")
+	out = captureStdout(t, func() {
+		PayoutCmd.SetArgs([]string{"claim", "100", "--signer", signer.String(), "-e", "10-11"})
+		err = PayoutCmd.Execute()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.sent) != 1 || !strings.Contains(out, "claim sent, action hash ") {
+		t.Fatalf("Expect the claim sent, get %d actions and %q", len(s.sent), out)
+	}
+	data, err := ioutil.ReadFile(claimRecordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record ClaimRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Address != signer.String() || record.Amount != "100000000000000000000" ||
+		record.FirstEpoch != 10 || record.LastEpoch != 11 || record.ActionHash == "" {
+		t.Errorf("Unexpected claim record %+v", record)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// status of a voter between two runs
+const (
+	voterAdded   = "added"
+	voterRemoved = "removed"
+	voterChanged = "changed"
+)
+
+// Flags
+var (
+	diffJson bool
+	diffAll  bool
+)
+
+var DiffCmd = &cobra.Command{
+	Use:   "diff OLD_REWARDSHARES NEW_REWARDSHARES",
+	Short: "Compares the reward shares of two runs voter by voter",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		old, err := loadRewardShares(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		updated, err := loadRewardShares(args[1])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		d := diffRewardShares(old, updated, diffAll)
+		if diffJson {
+			fmt.Println(d.String())
+		} else {
+			fmt.Print(d.Table())
+		}
+	},
+}
+
+func init() {
+	DiffCmd.Flags().BoolVar(&diffJson, "json", false, "output in JSON instead of a table")
+	DiffCmd.Flags().BoolVar(&diffAll, "all", false, "list voters whose reward did not change as well")
+
+	PayoutCmd.AddCommand(DiffCmd)
+}
+
+// Reward of a voter, or of the delegate, in both runs
+type RewardDiff struct {
+	Old   Reward `json:"old"`
+	New   Reward `json:"new"`
+	Delta Reward `json:"delta"`
+}
+
+type VoterDiff struct {
+	IOAddr  string `json:"ioaddr"`
+	ETHAddr string `json:"ethaddr"`
+	// added, removed, changed or empty if unchanged
+	Status string `json:"status"`
+	RewardDiff
+}
+
+type RewardSharesDiff struct {
+	OldEpochNum string `json:"oldepochnum"`
+	NewEpochNum string `json:"newepochnum"`
+	// reward of all voters, and gross reward of the delegate
+	Total    RewardDiff  `json:"total"`
+	Delegate RewardDiff  `json:"delegate"`
+	Voters   []VoterDiff `json:"voters"`
+	Added    int         `json:"added"`
+	Removed  int         `json:"removed"`
+	Changed  int         `json:"changed"`
+}
+
+// read rewardshares in the format of RewardShares.String(). The output of a
+// manifest payout is refused, as it would be read as rewardshares without any
+// voter.
+func loadRewardShares(path string) (*RewardShares, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mp MultiPayout
+	if json.Unmarshal(data, &mp) == nil && mp.Delegates != nil {
+		return nil, fmt.Errorf("%s is the output of a manifest payout, "+
+			"compare the rewardshares of each delegate instead", path)
+	}
+	rs := NewRewardShares()
+	if err := json.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("invalid rewardshares %s: %v", path, err)
+	}
+	if rs.EpochNum == "" {
+		return nil, fmt.Errorf("invalid rewardshares %s: no epochnum", path)
+	}
+	return rs, nil
+}
+
+func subReward(self Reward, other Reward) Reward {
+	strsub := func(a string, b string) string {
+		return new(big.Int).Sub(rau(a), rau(b)).Text(10)
+	}
+	return Reward{
+		strsub(self.Block, other.Block),
+		strsub(self.FoundationBonus, other.FoundationBonus),
+		strsub(self.EpochBonus, other.EpochBonus),
+	}
+}
+
+// sum of all reward types
+func (r Reward) total() *big.Int {
+	total := new(big.Int).Add(rau(r.Block), rau(r.FoundationBonus))
+	return total.Add(total, rau(r.EpochBonus))
+}
+
+// parse an amount in rau, empty or invalid amounts are 0
+func rau(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return v
+}
+
+func newRewardDiff(old Reward, updated Reward) RewardDiff {
+	return RewardDiff{old, updated, subReward(updated, old)}
+}
+
+// sum of the rewards of all voters
+func votersReward(rs *RewardShares) Reward {
+	total := Reward{"0", "0", "0"}
+	for _, share := range rs.Shares {
+		total = addReward(total, share.Reward)
+	}
+	return total
+}
+
+// Compare two rewardshares, voters are ordered by address. Voters whose
+// reward did not change are left out unless all is set.
+func diffRewardShares(old *RewardShares, updated *RewardShares, all bool) *RewardSharesDiff {
+	zero := Reward{"0", "0", "0"}
+	d := &RewardSharesDiff{
+		OldEpochNum: old.EpochNum,
+		NewEpochNum: updated.EpochNum,
+		Total:       newRewardDiff(votersReward(old), votersReward(updated)),
+		Delegate:    newRewardDiff(old.Reward, updated.Reward),
+	}
+
+	olds := make(map[string]Share)
+	for _, share := range old.Shares {
+		olds[share.ETHAddr] = share
+	}
+	news := make(map[string]Share)
+	for _, share := range updated.Shares {
+		news[share.ETHAddr] = share
+	}
+
+	var addrs []string
+	for addr := range olds {
+		addrs = append(addrs, addr)
+	}
+	for addr := range news {
+		if _, ok := olds[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		o, inOld := olds[addr]
+		n, inNew := news[addr]
+		var vd VoterDiff
+		switch {
+		case !inOld:
+			d.Added++
+			vd = VoterDiff{n.IOAddr, addr, voterAdded, newRewardDiff(zero, n.Reward)}
+		case !inNew:
+			d.Removed++
+			vd = VoterDiff{o.IOAddr, addr, voterRemoved, newRewardDiff(o.Reward, zero)}
+		default:
+			vd = VoterDiff{n.IOAddr, addr, "", newRewardDiff(o.Reward, n.Reward)}
+			if vd.Delta != zero {
+				d.Changed++
+				vd.Status = voterChanged
+			}
+		}
+		if vd.Status != "" || all {
+			d.Voters = append(d.Voters, vd)
+		}
+	}
+	return d
+}
+
+// Debug string
+func (d *RewardSharesDiff) String() string {
+	d_str, _ := json.MarshalIndent(d, "", "    ")
+	return string(d_str)
+}
+
+// Table of the reward deltas in rau
+func (d *RewardSharesDiff) Table() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "VOTER\tSTATUS\tBLOCK\tFOUNDATION\tEPOCH\tTOTAL\tOLD TOTAL\tNEW TOTAL\t")
+	row := func(voter string, status string, rd RewardDiff) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", voter, status,
+			rd.Delta.Block, rd.Delta.FoundationBonus, rd.Delta.EpochBonus,
+			rd.Delta.total(), rd.Old.total(), rd.New.total())
+	}
+	for _, vd := range d.Voters {
+		row(vd.IOAddr, vd.Status, vd.RewardDiff)
+	}
+	row("total", "", d.Total)
+	row("delegate", "", d.Delegate)
+	w.Flush()
+	fmt.Fprintf(&buf, "epochs %s -> %s: %d added, %d removed, %d changed\n",
+		d.OldEpochNum, d.NewEpochNum, d.Added, d.Removed, d.Changed)
+	return buf.String()
+}
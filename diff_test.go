@@ -0,0 +1,111 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffRewardShares(t *testing.T) {
+	old := &RewardShares{"1-2", 10, nil, Reward{"300", "30", "3000"}, []Share{
+		{"io1a", "a", nil, nil, nil, Reward{"100", "10", "1000"}, nil, ""},
+		{"io1b", "b", nil, nil, nil, Reward{"100", "10", "1000"}, nil, ""},
+		{"io1c", "c", nil, nil, nil, Reward{"100", "10", "1000"}, nil, ""},
+	}, nil}
+	updated := &RewardShares{"1-2", 10, nil, Reward{"300", "30", "3000"}, []Share{
+		{"io1d", "d", nil, nil, nil, Reward{"50", "5", "500"}, nil, ""},
+		{"io1b", "b", nil, nil, nil, Reward{"100", "10", "1000"}, nil, ""},
+		{"io1a", "a", nil, nil, nil, Reward{"150", "15", "1500"}, nil, ""},
+	}, nil}
+
+	d := diffRewardShares(old, updated, false)
+	if d.Added != 1 || d.Removed != 1 || d.Changed != 1 {
+		t.Fatalf("Expect 1 added, 1 removed and 1 changed, get %d, %d and %d",
+			d.Added, d.Removed, d.Changed)
+	}
+	if len(d.Voters) != 3 {
+		t.Fatalf("Expect unchanged voter to be left out, get %d voters", len(d.Voters))
+	}
+	expected := []struct {
+		addr   string
+		status string
+		delta  Reward
+	}{
+		{"a", voterChanged, Reward{"50", "5", "500"}},
+		{"c", voterRemoved, Reward{"-100", "-10", "-1000"}},
+		{"d", voterAdded, Reward{"50", "5", "500"}},
+	}
+	for i, e := range expected {
+		vd := d.Voters[i]
+		if vd.ETHAddr != e.addr || vd.Status != e.status || vd.Delta != e.delta {
+			t.Errorf("Expect voter %s %s by %v, get %s %s by %v",
+				e.addr, e.status, e.delta, vd.ETHAddr, vd.Status, vd.Delta)
+		}
+	}
+	if d.Total.Delta != (Reward{"0", "0", "0"}) {
+		t.Errorf("Expect voters' total reward unchanged, get %v", d.Total.Delta)
+	}
+
+	if d = diffRewardShares(old, updated, true); len(d.Voters) != 4 {
+		t.Errorf("Expect all 4 voters listed, get %d", len(d.Voters))
+	}
+
+	// a higher commission leaves the delegate's reward unchanged, but not
+	// the voters'
+	commissioned := &RewardShares{"1-2", 10, nil, Reward{"300", "30", "3000"}, []Share{
+		{"io1a", "a", nil, nil, nil, Reward{"90", "9", "900"}, nil, ""},
+		{"io1b", "b", nil, nil, nil, Reward{"90", "9", "900"}, nil, ""},
+		{"io1c", "c", nil, nil, nil, Reward{"90", "9", "900"}, nil, ""},
+	}, nil}
+	d = diffRewardShares(old, commissioned, false)
+	if d.Changed != 3 || d.Total.Delta != (Reward{"-30", "-3", "-300"}) {
+		t.Errorf("Expect 3 voters changed by -333 in total, get %d by %v", d.Changed, d.Total.Delta)
+	}
+	if d.Delegate.Delta != (Reward{"0", "0", "0"}) {
+		t.Errorf("Expect delegate's reward unchanged, get %v", d.Delegate.Delta)
+	}
+}
+
+func TestLoadRewardShares(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		valid   bool
+	}{
+		{NewRewardShares().SetEpochNum("10-11").String(), true},
+		// output of a manifest payout
+		{(&MultiPayout{[]DelegatePayout{{Delegate: "delegate1", Shares: NewRewardShares().SetEpochNum("10-11")}},
+			nil}).String(), false},
+		{`{"shares": []}`, false},
+		{"[]", false},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, "rewardshares.json")
+		if err := ioutil.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadRewardShares(path); (err == nil) != test.valid {
+			t.Errorf("%d: expect valid %v, get %v", i, test.valid, err)
+		}
+	}
+}
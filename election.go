@@ -0,0 +1,90 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+// number of consensus delegates elected among the candidates, who share the
+// foundation bonus
+const numConsensusDelegates = 36
+
+// Flags
+var (
+	strictElection bool
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().BoolVar(&strictElection, "strict-election", false,
+		"fail when the ranking computed from the votes does not match the delegates on chain, "+
+			"pay according to the chain and explain in the notes by default")
+}
+
+// Standing of a delegate in an epoch
+//   - candidate: qualified by its votes and self-staking, ranked by votes
+//   - consensus delegate: one of the top candidates elected on chain
+//   - active block producer: consensus delegate producing blocks in the epoch
+type DelegateStatus struct {
+	// rank among the candidates from the votes, -1 if not a candidate
+	Rank int `json:"rank"`
+	// elected according to the ranking computed from the votes
+	RankedElected bool `json:"rankedelected"`
+	// consensus delegate according to the chain
+	Consensus bool `json:"consensus"`
+	// active block producer according to the chain
+	Active bool `json:"active"`
+}
+
+// get the standing of a delegate in an epoch, from the votes at the epoch's
+// gravity chain height and the epoch meta
+func delegateStatus(epochResponse *iotexapi.GetEpochMetaResponse, vs *VoteSnapshot, operator string, delegate []byte) DelegateStatus {
+	status := DelegateStatus{Rank: -1}
+	for rank, del := range vs.candidates() {
+		if bytes.Equal(delegate, del.name()) {
+			status.Rank = rank
+			status.RankedElected = rank < numConsensusDelegates
+			break
+		}
+	}
+	for _, bp := range epochResponse.GetBlockProducersInfo() {
+		if operator == bp.GetAddress() {
+			status.Consensus = true
+			status.Active = bp.GetActive()
+		}
+	}
+	return status
+}
+
+// describe the mismatch between the computed ranking and the chain, empty if
+// they agree
+func (s DelegateStatus) mismatch(epoch uint64) string {
+	if s.RankedElected == s.Consensus {
+		return ""
+	}
+	ranked := "not a candidate"
+	if s.Rank >= 0 {
+		ranked = fmt.Sprintf("ranked %d", s.Rank+1)
+	}
+	if s.Consensus {
+		return fmt.Sprintf("epoch %d: %s by votes but a consensus delegate on chain, "+
+			"paid as a consensus delegate", epoch, ranked)
+	}
+	return fmt.Sprintf("epoch %d: %s by votes but not a consensus delegate on chain, "+
+		"paid as a candidate", epoch, ranked)
+}
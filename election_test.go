@@ -0,0 +1,47 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestDelegateStatus(t *testing.T) {
+	meta := testEpochMeta(10, 7500000)
+	vs := testVoteSnapshot(7500000)
+
+	status := delegateStatus(meta, vs, testOperator, delegateName("delegate1"))
+	if status != (DelegateStatus{0, true, true, true}) {
+		t.Errorf("Expect delegate1 ranked first and active, get %+v", status)
+	}
+	if m := status.mismatch(10); m != "" {
+		t.Errorf("Expect no mismatch, get %q", m)
+	}
+
+	// ranked second by votes but not among the block producers on chain
+	status = delegateStatus(meta, vs, "io1other", delegateName("delegate2"))
+	if status != (DelegateStatus{1, true, false, false}) {
+		t.Errorf("Expect delegate2 ranked second and not on chain, get %+v", status)
+	}
+	expected := "epoch 10: ranked 2 by votes but not a consensus delegate on chain, paid as a candidate"
+	if m := status.mismatch(10); m != expected {
+		t.Errorf("Expect mismatch %q, get %q", expected, m)
+	}
+
+	status = delegateStatus(meta, vs, testOperator, delegateName("delegate3"))
+	if status.Rank != -1 || status.RankedElected || !status.Consensus {
+		t.Errorf("Expect delegate3 not a candidate, get %+v", status)
+	}
+}
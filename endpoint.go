@@ -0,0 +1,129 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Flags
+var (
+	endpoints  []string
+	insecure   bool
+	caCertFile string
+	apiTimeout time.Duration
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().StringSliceVar(&endpoints, "endpoint", nil,
+		"addresses of the IoTeX API, e.g. api.iotex.one:443, tried in order until one is reachable, "+
+			"the endpoint of the ioctl config by default")
+	PayoutCmd.PersistentFlags().BoolVar(&insecure, "insecure", false,
+		"connect to --endpoint without TLS")
+	PayoutCmd.PersistentFlags().StringVar(&caCertFile, "ca-cert", "",
+		"PEM file of the CA certificates trusted for TLS, the system ones by default")
+	PayoutCmd.PersistentFlags().DurationVar(&apiTimeout, "api-timeout", 30*time.Second,
+		"timeout of connecting to an endpoint and of each attempt of an API call")
+}
+
+// An endpoint of the IoTeX API
+type apiEndpoint struct {
+	addr   string
+	secure bool
+}
+
+// endpoints given by --endpoint, or the endpoint of the ioctl config
+func apiEndpoints() ([]apiEndpoint, error) {
+	var eps []apiEndpoint
+	for _, addr := range endpoints {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			eps = append(eps, apiEndpoint{addr, !insecure})
+		}
+	}
+	if len(eps) > 0 {
+		return eps, nil
+	}
+	if config.ReadConfig.Endpoint == "" {
+		return nil, errors.New(`no IoTeX API endpoint, use --endpoint or "ioctl config set endpoint"`)
+	}
+	return []apiEndpoint{{config.ReadConfig.Endpoint, config.ReadConfig.SecureConnect}}, nil
+}
+
+// TLS credentials trusting --ca-cert, or the system CAs
+func transportCredentials() (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{}
+	if caCertFile != "" {
+		pem, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", caCertFile)
+		}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// dial a single endpoint, waiting up to --api-timeout for it to be reachable
+func dialEndpoint(ep apiEndpoint, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append(opts, grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	if ep.secure {
+		creds, err := transportCredentials()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	return grpc.DialContext(ctx, ep.addr, opts...)
+}
+
+// connect to the first reachable endpoint of the IoTeX API
+func connectToEndpoint(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	eps, err := apiEndpoints()
+	if err != nil {
+		return nil, err
+	}
+	var failures []string
+	for _, ep := range eps {
+		conn, err := dialEndpoint(ep, opts...)
+		if err == nil {
+			return conn, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", ep.addr, err))
+	}
+	return nil, fmt.Errorf("no IoTeX API endpoint reachable\n%s", strings.Join(failures, "\n"))
+}
+
+// context of a single API call made within ctx, whose attempts are each limited by
+// --api-timeout, see apiSession.invoke
+func apiContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
+}
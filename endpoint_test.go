@@ -0,0 +1,369 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-core/protogen/iotextypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// In-process IoTeX API serving fixtures. Methods the payout does not call
+// are left to the embedded interface and panic.
+type fakeAPIServer struct {
+	iotexapi.APIServiceServer
+	// number of GetChainMeta calls failing as unavailable first
+	unavailable int
+	current     uint64
+	epochs      map[uint64]*iotexapi.GetEpochMetaResponse
+	unclaimed   map[string]string
+	balances    map[string]string
+	gasPrice    uint64
+	// delay of GetEpochMeta, cut short when the call is cancelled
+	delay time.Duration
+	// receipts by action hash
+	receipts map[string]*iotextypes.Receipt
+	// actions sent
+	sent []*iotextypes.Action
+	// height of the chain, and time of its first block, each next one
+	// coming 10 seconds later
+	height  uint64
+	genesis time.Time
+}
+
+func (s *fakeAPIServer) GetBlockMetas(ctx context.Context, in *iotexapi.GetBlockMetasRequest) (*iotexapi.GetBlockMetasResponse, error) {
+	height := in.GetByIndex().GetStart()
+	if height == 0 || height > s.height {
+		return &iotexapi.GetBlockMetasResponse{}, nil
+	}
+	ts, err := ptypes.TimestampProto(s.genesis.Add(time.Duration(height-1) * 10 * time.Second))
+	if err != nil {
+		return nil, err
+	}
+	return &iotexapi.GetBlockMetasResponse{
+		BlkMetas: []*iotextypes.BlockMeta{{Height: height, Timestamp: ts}},
+	}, nil
+}
+
+func (s *fakeAPIServer) SendAction(ctx context.Context, in *iotexapi.SendActionRequest) (*iotexapi.SendActionResponse, error) {
+	s.sent = append(s.sent, in.GetAction())
+	return &iotexapi.SendActionResponse{}, nil
+}
+
+func (s *fakeAPIServer) GetReceiptByAction(ctx context.Context, in *iotexapi.GetReceiptByActionRequest) (*iotexapi.GetReceiptByActionResponse, error) {
+	receipt, ok := s.receipts[in.GetActionHash()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "receipt not found")
+	}
+	return &iotexapi.GetReceiptByActionResponse{ReceiptInfo: &iotexapi.ReceiptInfo{Receipt: receipt}}, nil
+}
+
+func (s *fakeAPIServer) GetChainMeta(ctx context.Context, in *iotexapi.GetChainMetaRequest) (*iotexapi.GetChainMetaResponse, error) {
+	if s.unavailable > 0 {
+		s.unavailable--
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &iotexapi.GetChainMetaResponse{ChainMeta: &iotextypes.ChainMeta{
+		Height: s.height,
+		Epoch:  &iotextypes.EpochData{Num: s.current},
+	}}, nil
+}
+
+func (s *fakeAPIServer) GetEpochMeta(ctx context.Context, in *iotexapi.GetEpochMetaRequest) (*iotexapi.GetEpochMetaResponse, error) {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	epoch, ok := s.epochs[in.GetEpochNumber()]
+	if !ok {
+		return nil, fmt.Errorf("epoch %d not found", in.GetEpochNumber())
+	}
+	return epoch, nil
+}
+
+func (s *fakeAPIServer) ReadState(ctx context.Context, in *iotexapi.ReadStateRequest) (*iotexapi.ReadStateResponse, error) {
+	// reading the state fails without unclaimed balances
+	if s.unclaimed == nil {
+		return nil, status.Error(codes.Internal, "state not found")
+	}
+	balance, ok := s.unclaimed[string(in.GetArguments()[0])]
+	if !ok {
+		balance = "0"
+	}
+	return &iotexapi.ReadStateResponse{Data: []byte(balance)}, nil
+}
+
+func (s *fakeAPIServer) GetAccount(ctx context.Context, in *iotexapi.GetAccountRequest) (*iotexapi.GetAccountResponse, error) {
+	balance, ok := s.balances[in.GetAddress()]
+	if !ok {
+		balance = "0"
+	}
+	return &iotexapi.GetAccountResponse{AccountMeta: &iotextypes.AccountMeta{
+		Address: in.GetAddress(), Balance: balance,
+	}}, nil
+}
+
+func (s *fakeAPIServer) SuggestGasPrice(ctx context.Context, in *iotexapi.SuggestGasPriceRequest) (*iotexapi.SuggestGasPriceResponse, error) {
+	return &iotexapi.SuggestGasPriceResponse{GasPrice: s.gasPrice}, nil
+}
+
+// serve the fake API on a local port and point --endpoint to it without TLS, returns a
+// function stopping the server and restoring the endpoint and caches
+func startFakeAPIServer(t *testing.T, s *fakeAPIServer, votes []*VoteSnapshot) func() {
+	addr, stopServer := serveFakeAPI(t, s)
+
+	// votes come from the gravity chain, not from the API
+	restore := useOfflineChainData(nil, votes)
+	offline = false
+	epochMetas = newMemo(chainDataCacheSize)
+	endpointsOrig, insecureOrig := endpoints, insecure
+	endpoints, insecure = []string{addr}, true
+	latestCheckedAt = time.Time{}
+	session.close()
+	return func() {
+		stopServer()
+		restore()
+		endpoints, insecure = endpointsOrig, insecureOrig
+		latestCheckedAt = time.Time{}
+		session.close()
+	}
+}
+
+// serve the fake API on a local port, returns its address and a function
+// stopping it
+func serveFakeAPI(t *testing.T, s *fakeAPIServer) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	iotexapi.RegisterAPIServiceServer(server, s)
+	go server.Serve(lis)
+	return lis.Addr().String(), server.Stop
+}
+
+// fake API where epoch 12 is the current one
+func testAPIServer() *fakeAPIServer {
+	s := &fakeAPIServer{
+		current:   12,
+		epochs:    make(map[uint64]*iotexapi.GetEpochMetaResponse),
+		unclaimed: map[string]string{testRewardAddress: "150000000000000000000"},
+		balances:  make(map[string]string),
+		gasPrice:  1000000000000,
+	}
+	for num := uint64(10); num <= 12; num++ {
+		s.epochs[num] = testEpochMeta(num, 7500000+(num-10)*100)
+	}
+	return s
+}
+
+func TestEndpoint(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), nil)
+	defer stop()
+
+	if num := currentEpochNum(context.Background()); num != 12 {
+		t.Errorf("Expect current epoch 12, get %d", num)
+	}
+	if h := epochGravityHeight(getEpochResponse(context.Background(), 11)); h != 7500100 {
+		t.Errorf("Expect gravity height 7500100, get %d", h)
+	}
+	// completed epochs are kept, the current one is fetched again
+	if epochMetas.get(uint64(11)) == nil {
+		t.Error("Expect epoch 11 to be cached")
+	}
+	getEpochResponse(context.Background(), 12)
+	if epochMetas.get(uint64(12)) != nil {
+		t.Error("Expect current epoch not to be cached")
+	}
+	if r := unclaimedReward(testRewardAddress).String(); r != "150000000000000000000" {
+		t.Errorf("Expect unclaimed reward 150000000000000000000, get %s", r)
+	}
+}
+
+func TestPayoutCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100), testVoteSnapshot(7500200)})
+	defer stop()
+	defer func(block, foundation, epoch int64, epochs string, output string, batches string) {
+		blockComm, foundationComm, epochComm = block, foundation, epoch
+		epochToQuery, outputFile, batchDir = epochs, output, batches
+	}(blockComm, foundationComm, epochComm, epochToQuery, outputFile, batchDir)
+
+	// the operator is looked up from the registration of delegate1
+	PayoutCmd.SetArgs([]string{"delegate1", "-e", "10-11", "-b", "10", "-f", "10", "-p", "10",
+		"-o", filepath.Join(dir, "shares.json"), "--batch-dir", dir})
+	if err := PayoutCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// per epoch, 90% of 240 block reward, 80 foundation bonus and 4687.5
+	// epoch bonus split 2:1 between the voters of delegate1
+	sent, err := ioutil.ReadFile(filepath.Join(dir, "batch-001.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"recipient":"0x45831656370acf0b345cc25558dc9b3b1424ddc3","amount":"6009"},` +
+		`{"recipient":"0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c","amount":"3004.5"}]`
+	if string(sent) != expected {
+		t.Errorf("Expect multisend input %s, get %s", expected, sent)
+	}
+	rs, err := loadRewardShares(filepath.Join(dir, "shares.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.EpochNum != "10-11" || len(rs.Shares) != 2 {
+		t.Errorf("Expect 2 shares for epochs 10-11, get %d for %s", len(rs.Shares), rs.EpochNum)
+	}
+}
+
+func TestEndpointFailover(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), nil)
+	defer stop()
+
+	// nothing listens on a closed port
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := lis.Addr().String()
+	lis.Close()
+
+	endpoints = []string{dead, endpoints[0]}
+	session.close()
+	if num := currentEpochNum(context.Background()); num != 12 {
+		t.Errorf("Expect current epoch 12 from the second endpoint, get %d", num)
+	}
+
+	endpoints = []string{dead}
+	if _, err := connectToEndpoint(); err == nil || !strings.Contains(err.Error(), dead) {
+		t.Errorf("Expect error naming the unreachable endpoint, get %v", err)
+	}
+}
+
+func TestAPIEndpoints(t *testing.T) {
+	defer func(eps []string, plain bool, ca string) {
+		endpoints, insecure, caCertFile = eps, plain, ca
+	}(endpoints, insecure, caCertFile)
+
+	endpoints, insecure = []string{"api.iotex.one:443", " ", "backup:443"}, false
+	eps, err := apiEndpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []apiEndpoint{{"api.iotex.one:443", true}, {"backup:443", true}}
+	if !reflect.DeepEqual(eps, expected) {
+		t.Errorf("Expect endpoints %v, get %v", expected, eps)
+	}
+	insecure = true
+	if eps, _ := apiEndpoints(); eps[0].secure {
+		t.Error("Expect --insecure to disable TLS")
+	}
+
+	f, err := ioutil.TempFile("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+	caCertFile = f.Name()
+	if _, err := transportCredentials(); err == nil {
+		t.Error("Expect error for a CA file without certificate")
+	}
+}
+
+func TestSessionReconnect(t *testing.T) {
+	defer func(eps []string, plain bool, backoff time.Duration) {
+		endpoints, insecure, retryBackoff = eps, plain, backoff
+		session.close()
+	}(endpoints, insecure, retryBackoff)
+	retryBackoff = time.Millisecond
+	addr, stop := serveFakeAPI(t, testAPIServer())
+	defer stop()
+	backup := testAPIServer()
+	backup.current = 13
+	backupAddr, stopBackup := serveFakeAPI(t, backup)
+	defer stopBackup()
+	endpoints, insecure = []string{addr, backupAddr}, true
+	session.close()
+
+	// the connection is kept across calls
+	currentEpochNum(context.Background())
+	conn := session.conn
+	unclaimedReward(testRewardAddress)
+	if session.conn != conn {
+		t.Error("Expect the connection to be reused")
+	}
+
+	// calls fail over to the backup endpoint once the first one goes away,
+	// also those of clients created before
+	cli, err := session.client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if num := currentEpochNum(context.Background()); num != 13 {
+		t.Errorf("Expect current epoch 13 from the backup endpoint, get %d", num)
+	}
+	response, err := cli.GetChainMeta(context.Background(), &iotexapi.GetChainMetaRequest{})
+	if err != nil || response.GetChainMeta().GetEpoch().GetNum() != 13 {
+		t.Errorf("Expect the old client to call the backup endpoint, get %v %v", response, err)
+	}
+}
+
+func TestSessionRetireInUse(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), nil)
+	defer stop()
+
+	currentEpochNum(context.Background())
+	old := session.conn
+	// a call still uses the connection while another replaces it
+	conn := session.acquire(old)
+	if err := session.reconnect(old); err != nil {
+		t.Fatal(err)
+	}
+	if session.conn == old {
+		t.Fatal("Expect the connection to be replaced")
+	}
+	if old.GetState() == connectivity.Shutdown {
+		t.Error("Expect the connection in use not to be closed")
+	}
+	session.release(conn)
+	if old.GetState() != connectivity.Shutdown {
+		t.Error("Expect the replaced connection to be closed by its last call")
+	}
+}
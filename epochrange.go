@@ -0,0 +1,244 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Epoch range expression, a comma separated list of
+//   10         a single epoch
+//   1-10       an inclusive range of epochs
+//   current    the current epoch, current-1 for the previous one
+//   last:24    the last 24 completed epochs
+//   2019-06-01..2019-06-07
+//              the epochs overlapping a period of time, either dates or
+//              RFC3339 times. A date as end includes the whole day
+//   since-last-paid
+//              the completed epochs after the last one paid out
+const epochRangeUsage = "epoch(s) to calculate rewards, current epoch by default. " +
+	"The input is a comma separated list of epochs (e.g. 4), ranges (e.g. 1-2,7-10), " +
+	"current or current-N, last:N for the last N completed epochs, " +
+	"date ranges (e.g. 2019-06-01..2019-06-07) and since-last-paid"
+
+// resolves the relative parts of an epoch range expression
+type epochResolver struct {
+	// current epoch number
+	current func() uint64
+	// epoch in progress at the given time
+	epochAt func(t time.Time) (uint64, error)
+	// last epoch paid out, 0 if never paid
+	lastPaid func() (uint64, error)
+}
+
+// Parse an epoch range expression to sorted epoch numbers without duplicates
+func parseEpochRange(expr string, r *epochResolver) ([]uint64, error) {
+	seen := make(map[uint64]bool)
+	var epochs []uint64
+	add := func(first, last uint64) {
+		for e := first; e <= last; e++ {
+			if !seen[e] {
+				seen[e] = true
+				epochs = append(epochs, e)
+			}
+		}
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		first, last, err := parseEpochRangePart(part, r)
+		if err != nil {
+			return nil, err
+		}
+		if first == 0 {
+			return nil, fmt.Errorf("invalid epoch range %q, epochs start at 1", part)
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid epoch range %q, %d is before %d", part, last, first)
+		}
+		if current := r.current(); last > current {
+			return nil, fmt.Errorf("invalid epoch range %q, epoch %d is after the current epoch %d",
+				part, last, current)
+		}
+		add(first, last)
+	}
+
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+	return epochs, nil
+}
+
+// parse a single part of the expression into an inclusive range
+func parseEpochRangePart(part string, r *epochResolver) (uint64, uint64, error) {
+	switch {
+	case part == "":
+		return 0, 0, fmt.Errorf("empty epoch range")
+
+	case part == "since-last-paid":
+		paid, err := r.lastPaid()
+		if err != nil {
+			return 0, 0, err
+		}
+		current := r.current()
+		if paid+1 >= current {
+			return 0, 0, fmt.Errorf("no completed epoch since last paid epoch %d", paid)
+		}
+		return paid + 1, current - 1, nil
+
+	case strings.HasPrefix(part, "last:"):
+		n, err := strconv.ParseUint(part[len("last:"):], 10, 64)
+		if err != nil || n == 0 {
+			return 0, 0, fmt.Errorf("invalid epoch range %q, expect last:N with N > 0", part)
+		}
+		current := r.current()
+		if n >= current {
+			return 0, 0, fmt.Errorf("invalid epoch range %q, only %d epochs completed", part, current-1)
+		}
+		return current - n, current - 1, nil
+
+	case strings.HasPrefix(part, "current"):
+		current := r.current()
+		if part == "current" {
+			return current, current, nil
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(part, "current-"), 10, 64)
+		if err != nil || !strings.HasPrefix(part, "current-") {
+			return 0, 0, fmt.Errorf("invalid epoch range %q, expect current or current-N", part)
+		}
+		if n >= current {
+			return 0, 0, fmt.Errorf("invalid epoch range %q, current epoch is %d", part, current)
+		}
+		return current - n, current - n, nil
+
+	case strings.Contains(part, ".."):
+		i := strings.Index(part, "..")
+		start, _, err := parseEpochTime(part[:i])
+		if err != nil {
+			return 0, 0, err
+		}
+		end, isDate, err := parseEpochTime(part[i+2:])
+		if err != nil {
+			return 0, 0, err
+		}
+		if isDate {
+			end = end.Add(24*time.Hour - time.Nanosecond)
+		}
+		if end.Before(start) {
+			return 0, 0, fmt.Errorf("invalid epoch range %q, end is before start", part)
+		}
+		first, err := r.epochAt(start)
+		if err != nil {
+			return 0, 0, err
+		}
+		last, err := r.epochAt(end)
+		if err != nil {
+			return 0, 0, err
+		}
+		return first, last, nil
+	}
+
+	// absolute epochs: 10 or 1-10
+	if i := strings.Index(part, "-"); i != -1 {
+		n1, err := strconv.ParseUint(part[:i], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid epoch range %q", part)
+		}
+		n2, err := strconv.ParseUint(part[i+1:], 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid epoch range %q", part)
+		}
+		return n1, n2, nil
+	}
+	n, err := strconv.ParseUint(part, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid epoch %q", part)
+	}
+	return n, n, nil
+}
+
+// parse a date or RFC3339 time, also reports whether it is a date
+func parseEpochTime(s string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q, expect 2006-01-02 or RFC3339", s)
+	}
+	return t, false, nil
+}
+
+// resolver backed by the chain and the payout record of the delegates
+func chainEpochResolver(ctx context.Context, delegates ...[]byte) *epochResolver {
+	return &epochResolver{
+		current: func() uint64 {
+			return latestEpoch(ctx)
+		},
+		epochAt: func(t time.Time) (uint64, error) {
+			return epochAtTime(ctx, t)
+		},
+		lastPaid: func() (uint64, error) {
+			return lastPaidEpoch(recordFile, delegates...)
+		},
+	}
+}
+
+// Resolve an epoch range expression against the chain, current epoch if empty
+func resolveEpochs(ctx context.Context, epochs string, delegates ...[]byte) ([]uint64, error) {
+	if epochs == "" {
+		return []uint64{currentEpochNum(ctx)}, nil
+	}
+	return parseEpochRange(epochs, chainEpochResolver(ctx, delegates...))
+}
+
+// list the epochs of a range, current epoch if empty
+func epochList(ctx context.Context, epochs string, delegates ...[]byte) []uint64 {
+	list, err := resolveEpochs(ctx, epochs, delegates...)
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+// epoch in progress at the given time, found by binary search on the
+// timestamp of the first block of each epoch. Fails on a time before the
+// first epoch or after the latest block, which no epoch covers yet.
+func epochAtTime(ctx context.Context, t time.Time) (uint64, error) {
+	latest := latestEpoch(ctx)
+	if first := blockTime(ctx, epochHeight(getEpochResponse(ctx, 1))); t.Before(first) {
+		return 0, fmt.Errorf("%s is before the first epoch, started at %s",
+			t.Format(time.RFC3339), first.Format(time.RFC3339))
+	}
+	if tip := blockTime(ctx, chainMeta(ctx).GetHeight()); t.After(tip) {
+		return 0, fmt.Errorf("%s is after the latest block, produced at %s",
+			t.Format(time.RFC3339), tip.Format(time.RFC3339))
+	}
+
+	lo, hi := uint64(1), latest
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		start := blockTime(ctx, epochHeight(getEpochResponse(ctx, mid)))
+		if start.After(t) {
+			hi = mid - 1
+		} else {
+			lo = mid
+		}
+	}
+	return lo, nil
+}
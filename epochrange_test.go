@@ -0,0 +1,104 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// resolver with epoch 100 as current epoch, epoch 1 starting at 2019-04-22
+// and lasting one hour each, and epoch 90 as last paid epoch
+func testEpochResolver() *epochResolver {
+	genesis := time.Date(2019, 4, 22, 0, 0, 0, 0, time.UTC)
+	return &epochResolver{
+		current: func() uint64 { return 100 },
+		epochAt: func(t time.Time) (uint64, error) {
+			return uint64(t.Sub(genesis)/time.Hour) + 1, nil
+		},
+		lastPaid: func() (uint64, error) { return 90, nil },
+	}
+}
+
+func TestParseEpochRange(t *testing.T) {
+	r := testEpochResolver()
+	tests := []struct {
+		expr     string
+		expected []uint64
+	}{
+		{"4", []uint64{4}},
+		{"1-2,4,7-10", []uint64{1, 2, 4, 7, 8, 9, 10}},
+		{"7-10,4,8-12,4", []uint64{4, 7, 8, 9, 10, 11, 12}},
+		{"current", []uint64{100}},
+		{"current-1", []uint64{99}},
+		{"last:3", []uint64{97, 98, 99}},
+		{"since-last-paid", []uint64{91, 92, 93, 94, 95, 96, 97, 98, 99}},
+		{"2019-04-22..2019-04-22", []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+			13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24}},
+		{"2019-04-23T01:30:00Z..2019-04-23T03:00:00Z", []uint64{26, 27, 28}},
+	}
+	for _, test := range tests {
+		epochs, err := parseEpochRange(test.expr, r)
+		if err != nil {
+			t.Fatalf("Unexpected error on %q: %v", test.expr, err)
+		}
+		if !reflect.DeepEqual(epochs, test.expected) {
+			t.Fatalf("Expect %v for %q, but actual obtained %v", test.expected, test.expr, epochs)
+		}
+	}
+}
+
+func TestParseEpochRangeInvalid(t *testing.T) {
+	r := testEpochResolver()
+	for _, expr := range []string{
+		"", "1,,2", "0", "10-5", "abc", "1-x", "101", "current-100",
+		"current+1", "last:0", "last:100", "2019-04-23..2019-04-22", "2019-13-01..2019-13-02",
+	} {
+		if epochs, err := parseEpochRange(expr, r); err == nil {
+			t.Fatalf("Expect error on %q, but actual obtained %v", expr, epochs)
+		}
+	}
+}
+
+func TestChainEpochResolver(t *testing.T) {
+	// 12 epochs of 360 blocks of 10 seconds, epoch 12 half way through
+	s := testAPIServer()
+	for num := uint64(1); num < 10; num++ {
+		s.epochs[num] = testEpochMeta(num, 7500000-(10-num)*100)
+	}
+	s.genesis = time.Date(2019, 4, 22, 0, 0, 0, 0, time.UTC)
+	s.height = 11*360 + 180
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+
+	epochs, err := resolveEpochs(context.Background(), "2019-04-22T01:30:00Z..2019-04-22T03:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(epochs, []uint64{2, 3, 4}) {
+		t.Errorf("Expect epochs 2-4, get %v", epochs)
+	}
+
+	// times no completed or running epoch covers
+	for _, expr := range []string{
+		"2019-04-21..2019-04-22T05:00:00Z", "2030-01-01..2030-01-07", "2019-04-22..2019-04-22",
+	} {
+		if epochs, err := resolveEpochs(context.Background(), expr); err == nil {
+			t.Errorf("Expect error on %q, get %v", expr, epochs)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+// Flags
+var (
+	payer            string
+	gasPerRecipient  uint64
+	multisendGasBase uint64
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().StringVar(&payer, "payer", "",
+		"alias or address of the account sending the multisend, to check it holds enough IOTX")
+	PayoutCmd.PersistentFlags().Uint64Var(&gasPerRecipient, "gas-per-recipient", 30000,
+		"estimated gas of the multisend for each recipient")
+	PayoutCmd.PersistentFlags().Uint64Var(&multisendGasBase, "gas-base", 50000,
+		"estimated gas of the multisend besides the recipients")
+}
+
+// Funding of a payout by the payer, amounts in IOTX
+type FundingReport struct {
+	Payer      string `json:"payer"`
+	Balance    string `json:"balance"`
+	Recipients int    `json:"recipients"`
+	Payout     string `json:"payout"`
+	Gas        string `json:"gas"`
+	Required   string `json:"required"`
+	// unclaimed reward of the delegates' reward addresses
+	Unclaimed string `json:"unclaimed"`
+	Funded    bool   `json:"funded"`
+	// problems found, empty if funded
+	Problems []string `json:"problems"`
+}
+
+// total amount in rau and number of recipients of a multisend input
+func multisendTotal(sent string) (*big.Int, int, error) {
+	var rewards []MultisendReward
+	if err := json.Unmarshal([]byte(sent), &rewards); err != nil {
+		return nil, 0, fmt.Errorf("invalid multisend input: %v", err)
+	}
+	total := new(big.Int)
+	for _, r := range rewards {
+		amount, err := util.StringToRau(r.Amount, util.IotxDecimalNum)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid amount %s to %s: %v", r.Amount, r.Recipient, err)
+		}
+		total.Add(total, amount)
+	}
+	return total, len(rewards), nil
+}
+
+// estimated gas of sending a multisend input, in a single action or in the
+// batches written with --batch-dir, each of which pays the base gas
+func multisendInputGas(sent string) (uint64, error) {
+	var rewards []MultisendReward
+	if err := json.Unmarshal([]byte(sent), &rewards); err != nil {
+		return 0, fmt.Errorf("invalid multisend input: %v", err)
+	}
+	if batchDir == "" {
+		return multisendGas(len(rewards)), nil
+	}
+	batches, err := splitMultisend(rewards, batchSize, batchGas)
+	if err != nil {
+		return 0, err
+	}
+	var gas uint64
+	for _, batch := range batches {
+		gas += multisendGas(len(batch))
+	}
+	return gas, nil
+}
+
+// compare what a payout requires with the payer's balance and the unclaimed
+// rewards, all amounts in rau
+func newFundingReport(payer string, balance *big.Int, unclaimed *big.Int, payout *big.Int, recipients int, estimatedGas uint64, gasPrice *big.Int) *FundingReport {
+	gas := new(big.Int).SetUint64(estimatedGas)
+	gas.Mul(gas, gasPrice)
+	required := new(big.Int).Add(payout, gas)
+
+	iotx := func(rau *big.Int) string { return util.RauToString(rau, util.IotxDecimalNum) }
+	r := &FundingReport{
+		Payer:      payer,
+		Balance:    iotx(balance),
+		Recipients: recipients,
+		Payout:     iotx(payout),
+		Gas:        iotx(gas),
+		Required:   iotx(required),
+		Unclaimed:  iotx(unclaimed),
+		Funded:     balance.Cmp(required) >= 0,
+	}
+	if !r.Funded {
+		shortfall := new(big.Int).Sub(required, balance)
+		problem := fmt.Sprintf("payer %s is short of %s IOTX", payer, iotx(shortfall))
+		if unclaimed.Cmp(shortfall) >= 0 {
+			problem += ", claiming the unclaimed reward would cover it"
+		}
+		r.Problems = append(r.Problems, problem)
+	}
+	if payout.Cmp(unclaimed) > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf(
+			"payout of %s IOTX exceeds the %s IOTX reward not claimed yet",
+			iotx(payout), r.Unclaimed))
+	}
+	return r
+}
+
+// Report
+func (r *FundingReport) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "payer %s balance: %s IOTX\n", r.Payer, r.Balance)
+	fmt.Fprintf(&buf, "payout to %d recipients: %s IOTX + %s IOTX estimated gas = %s IOTX\n",
+		r.Recipients, r.Payout, r.Gas, r.Required)
+	fmt.Fprintf(&buf, "unclaimed reward: %s IOTX\n", r.Unclaimed)
+	for _, p := range r.Problems {
+		fmt.Fprintf(&buf, "warning: %s\n", p)
+	}
+	if r.Funded {
+		buf.WriteString("funded")
+	} else {
+		buf.WriteString("UNDERFUNDED")
+	}
+	return buf.String()
+}
+
+// get the balance of an account in rau
+func accountBalance(addr string) *big.Int {
+	cli, err := session.client()
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := apiContext(context.Background())
+	defer cancel()
+	response, err := cli.GetAccount(ctx, &iotexapi.GetAccountRequest{Address: addr})
+	if err != nil {
+		panic(err)
+	}
+	balance, ok := new(big.Int).SetString(response.GetAccountMeta().GetBalance(), 10)
+	if !ok {
+		panic(fmt.Errorf("invalid balance of %s", addr))
+	}
+	return balance
+}
+
+// get the gas price suggested by the chain in rau
+func suggestGasPrice() *big.Int {
+	cli, err := session.client()
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := apiContext(context.Background())
+	defer cancel()
+	response, err := cli.SuggestGasPrice(ctx, &iotexapi.SuggestGasPriceRequest{})
+	if err != nil {
+		panic(err)
+	}
+	return new(big.Int).SetUint64(response.GetGasPrice())
+}
+
+// check that the payer holds enough IOTX for a multisend input and print
+// the report, returns whether it does. Always true without --payer.
+func checkFunding(sent string, rewardAddrs ...string) bool {
+	if payer == "" {
+		return true
+	}
+	payerAddr, err := alias.Address(payer)
+	if err != nil {
+		panic(err)
+	}
+	total, recipients, err := multisendTotal(sent)
+	if err != nil {
+		panic(err)
+	}
+	gas, err := multisendInputGas(sent)
+	if err != nil {
+		panic(err)
+	}
+	unclaimed := new(big.Int)
+	for _, addr := range rewardAddrs {
+		unclaimed.Add(unclaimed, unclaimedReward(addr))
+	}
+
+	r := newFundingReport(payerAddr, accountBalance(payerAddr), unclaimed,
+		total, recipients, gas, suggestGasPrice())
+	fmt.Println(r.String())
+	return r.Funded
+}
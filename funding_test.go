@@ -0,0 +1,105 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+)
+
+func TestFundingReport(t *testing.T) {
+	total, recipients, err := multisendTotal(
+		`[{"recipient":"0x01","amount":"1.5"},{"recipient":"0x02","amount":"98.5"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipients != 2 || util.RauToString(total, util.IotxDecimalNum) != "100" {
+		t.Fatalf("Expect 100 IOTX to 2 recipients, get %v to %d", total, recipients)
+	}
+
+	iotx := func(s string) *big.Int {
+		v, _ := util.StringToRau(s, util.IotxDecimalNum)
+		return v
+	}
+	// 50000 + 2 * 30000 gas at 1 Qev
+	gasPrice := big.NewInt(1000000000000)
+
+	r := newFundingReport("io1payer", iotx("101"), iotx("200"), total, recipients, multisendGas(recipients), gasPrice)
+	if !r.Funded || len(r.Problems) != 0 || r.Gas != "0.11" {
+		t.Errorf("Expect funded with 0.11 IOTX gas, get %+v", r)
+	}
+
+	r = newFundingReport("io1payer", iotx("50"), iotx("150"), total, recipients, multisendGas(recipients), gasPrice)
+	if r.Funded || len(r.Problems) != 1 {
+		t.Fatalf("Expect underfunded, get %+v", r)
+	}
+	if r.Problems[0] != "payer io1payer is short of 50.11 IOTX, claiming the unclaimed reward would cover it" {
+		t.Errorf("Unexpected problem %q", r.Problems[0])
+	}
+
+	r = newFundingReport("io1payer", iotx("50"), iotx("10"), total, recipients, multisendGas(recipients), gasPrice)
+	if r.Funded || len(r.Problems) != 2 {
+		t.Errorf("Expect underfunded with payout above unclaimed reward, get %+v", r)
+	}
+	// each batch pays the base gas
+	defer func(dir string, size int) { batchDir, batchSize = dir, size }(batchDir, batchSize)
+	batchDir, batchSize = "", 1
+	sent := `[{"recipient":"0x01","amount":"1.5"},{"recipient":"0x02","amount":"98.5"}]`
+	if gas, err := multisendInputGas(sent); err != nil || gas != 110000 {
+		t.Errorf("Expect 110000 gas in a single action, get %d %v", gas, err)
+	}
+	batchDir = "batches"
+	if gas, err := multisendInputGas(sent); err != nil || gas != 160000 {
+		t.Errorf("Expect 160000 gas in 2 batches, get %d %v", gas, err)
+	}
+}
+
+func TestPayoutUnderfunded(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100)})
+	defer stop()
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(e, r, p, b, s string, bc, fc, pc int64) {
+		epochToQuery, rewardAddress, payer, batchDir, snapshotDir = e, r, p, b, s
+		blockComm, foundationComm, epochComm = bc, fc, pc
+	}(epochToQuery, rewardAddress, payer, batchDir, snapshotDir, blockComm, foundationComm, epochComm)
+	epochToQuery, rewardAddress = "10-11", testRewardAddress
+	blockComm, foundationComm, epochComm = 10, 10, 10
+	// the payer has no balance, and the unclaimed reward would not cover the payout
+	payer = testOperator
+	batchDir, snapshotDir = filepath.Join(dir, "batches"), filepath.Join(dir, "snapshot")
+
+	var funded bool
+	captureStdout(t, func() { _, funded = payout("delegate1", testOperator) })
+	if funded {
+		t.Error("Expect the payout to be underfunded")
+	}
+	// the outputs are written all the same
+	if _, err := loadBatchManifest(batchDir); err != nil {
+		t.Errorf("Expect batches written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(snapshotDir, snapshotOutputFile)); err != nil {
+		t.Errorf("Expect snapshot written: %v", err)
+	}
+}
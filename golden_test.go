@@ -0,0 +1,167 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Golden cases are snapshot directories in testdata/golden, replayed offline
+// and compared with their output.json and multisend.json. The fixture-* cases
+// are not recorded from mainnet, they hold the synthetic chain data of the
+// other tests, and no mainnet case is checked in yet. Record one, e.g. into testdata/golden/iotexlab-1000-1001,
+// with
+//   go test -run TestGolden -record DELEGATE:EPOCHS -record-endpoint HOST:PORT
+// and refresh the expected outputs after an intended change with
+//   go test -run TestGolden -update
+// which also refreshes the hashes of hand-edited config.json files.
+const goldenDir = "testdata/golden"
+
+var (
+	updateGolden   = flag.Bool("update", false, "rewrite the expected outputs of the golden cases")
+	recordGolden   = flag.String("record", "", "record DELEGATE:EPOCHS from the chain as a golden case")
+	recordEndpoint = flag.String("record-endpoint", "", "IoTeX API endpoints to record from, as --endpoint")
+)
+
+// record the chain data and outputs of a payout as a golden case, without
+// commission so that every reward reaches the voters
+func recordGoldenCase(dir string, delegate string, epochs string) error {
+	epochNums := epochList(context.Background(), epochs, delegateName(delegate))
+	operator, reward, err := resolveDelegate(delegate, "", "", epochNums)
+	if err != nil {
+		return err
+	}
+	comm := Commission{0, 0, 0}
+
+	recorder = newSnapshotRecorder(dir)
+	defer func() { recorder = nil }()
+	output, sent := payoutEpochs(delegate, operator, epochs, epochNums, comm)
+	return recorder.save(newSnapshotConfig([]ManifestDelegate{{
+		Name:          delegate,
+		Operator:      operator,
+		RewardAddress: reward,
+		Commission:    &comm,
+	}}, epochs, epochNums), output, sent)
+}
+
+// rewrite the outputs of a golden case and the hashes of all its files
+func updateGoldenCase(dir string, s *snapshot, output string, sent string) error {
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotOutputFile), []byte(output), 0644); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, snapshotMultisendFile), []byte(sent), 0644); err != nil {
+		return err
+	}
+	for name := range s.manifest.Files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		s.manifest.Files[name] = sha256Hex(data)
+	}
+	data, _ := json.MarshalIndent(s.manifest, "", "    ")
+	return ioutil.WriteFile(filepath.Join(dir, snapshotManifestFile), data, 0644)
+}
+
+func TestGolden(t *testing.T) {
+	restore := useOfflineChainData(nil, nil)
+	defer restore()
+	defer func(config SnapshotConfig) { config.apply() }(newSnapshotConfig(nil, "", nil))
+
+	if *recordGolden != "" {
+		parts := strings.SplitN(*recordGolden, ":", 2)
+		if len(parts) != 2 {
+			t.Fatalf("invalid -record %s, expect DELEGATE:EPOCHS", *recordGolden)
+		}
+		endpointsOrig := endpoints
+		endpoints = strings.Split(*recordEndpoint, ",")
+		offline = false
+		epochMetas = newMemo(chainDataCacheSize)
+		voteSnapshots = newMemo(chainDataCacheSize)
+		dir := filepath.Join(goldenDir, fmt.Sprintf("%s-%s", parts[0], parts[1]))
+		err := recordGoldenCase(dir, parts[0], parts[1])
+		endpoints = endpointsOrig
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(goldenDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatalf("no golden case in %s", goldenDir)
+	}
+	recorded := 0
+	for _, dir := range dirs {
+		if !strings.HasPrefix(filepath.Base(dir), "fixture-") {
+			recorded++
+		}
+	}
+	if recorded == 0 {
+		t.Logf("no mainnet case in %s, only the synthetic fixture-* cases are replayed", goldenDir)
+	}
+	for _, dir := range dirs {
+		s, mismatches, err := loadSnapshot(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		output, sent, err := s.replay()
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		if *updateGolden {
+			if err := updateGoldenCase(dir, s, output, sent); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		for _, m := range mismatches {
+			t.Errorf("%s: %s", dir, m)
+		}
+		expected, err := ioutil.ReadFile(filepath.Join(dir, snapshotOutputFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output != string(expected) {
+			// show the changed rewards if the output is still rewardshares
+			var old, updated RewardShares
+			if json.Unmarshal(expected, &old) == nil && json.Unmarshal([]byte(output), &updated) == nil &&
+				old.EpochNum != "" {
+				t.Errorf("%s: reward shares differ from %s\n%s", dir, snapshotOutputFile,
+					diffRewardShares(&old, &updated, false).Table())
+			} else {
+				t.Errorf("%s: reward shares differ from %s\n%s", dir, snapshotOutputFile, output)
+			}
+		}
+		expected, err = ioutil.ReadFile(filepath.Join(dir, snapshotMultisendFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != string(expected) {
+			t.Errorf("%s: multisend input differs from %s\nexpected %s\nget      %s",
+				dir, snapshotMultisendFile, expected, sent)
+		}
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// version of the tool, recorded in snapshots
+const version = "0.2.0"
+
 // Flags
 var (
 	blockComm           int64
@@ -29,31 +32,70 @@ var (
 	outputFile          string
 	epochToQuery        string
 	simpleJson          bool
+	manifestFile        string
+	recordFile          string
+	bucketDetail        bool
+	voteSamples         int
 )
 
 var PayoutCmd = &cobra.Command{
-	Use:   "iotex_payout DELEGATE_NAME OPERATOR_[ALIAS|ADDRESS]",
+	Use:   "iotex_payout [DELEGATE_NAME [OPERATOR_[ALIAS|ADDRESS]] | -m MANIFEST]",
 	Short: "Calculates voters' reward shares for IOTEX blockchain, output the input for iotex multisend",
-	Args:  cobra.MinimumNArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		output := payout(args[0], args[1])
-		if outputFile == "" {
-			fmt.Println(output)
-			return
+	Version: version,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if manifestFile != "" {
+			return cobra.NoArgs(cmd, args)
 		}
-		f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			panic(err)
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
+	// the flags are only parsed by now, and this runs before every subcommand
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// buckets are those at the start of the epoch, they would not add up
+		// to the averaged votes the shares are split by
+		if bucketDetail && voteSamples > 1 {
+			return fmt.Errorf("--buckets cannot be combined with --vote-samples above 1")
 		}
-		if _, err := f.Write([]byte(output + "\n")); err != nil {
-			panic(err)
+		return defaultCommission().validate()
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var output string
+		var funded bool
+		if manifestFile != "" {
+			output, funded = payoutManifest(manifestFile)
+		} else {
+			// the operator is looked up from the registration if omitted
+			operator := ""
+			if len(args) > 1 {
+				operator = args[1]
+			}
+			output, funded = payout(args[0], operator)
 		}
-		if err := f.Close(); err != nil {
-			panic(err)
+		writeOutput(outputFile, output)
+		// the outputs are kept for a look, but the payout cannot be sent yet
+		if !funded {
+			os.Exit(1)
 		}
 	},
 }
 
+// append the output to a file, or print it to stdout if no file is given
+func writeOutput(file string, output string) {
+	if file == "" {
+		fmt.Println(output)
+		return
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := f.Write([]byte(output + "\n")); err != nil {
+		panic(err)
+	}
+	if err := f.Close(); err != nil {
+		panic(err)
+	}
+}
+
 func main() {
 	if err := PayoutCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -62,30 +104,26 @@ func main() {
 }
 
 func init() {
-	PayoutCmd.Flags().Int64VarP(&blockComm, "block-commission", "b", 100,
+	PayoutCmd.PersistentFlags().Int64VarP(&blockComm, "block-commission", "b", 100,
 		"commission rate of block reward, 100% by default")
-	PayoutCmd.Flags().Int64VarP(&epochComm, "epoch-commission", "p", 100,
+	PayoutCmd.PersistentFlags().Int64VarP(&epochComm, "epoch-commission", "p", 100,
 		"commission rate of epoch bonus, 100% by default")
-	PayoutCmd.Flags().Int64VarP(&foundationComm, "foundation-commission", "f", 100,
+	PayoutCmd.PersistentFlags().Int64VarP(&foundationComm, "foundation-commission", "f", 100,
 		"commission rate of foundation bonus, 100% by default")
 	PayoutCmd.Flags().StringVarP(&outputFile, "output", "o", "",
 		"file to output the result, output to stdout by default")
-	PayoutCmd.Flags().StringVarP(&epochToQuery, "epoch", "e", "",
-		"epoch(s) to calculate rewards, current epoch by default. " +
-		"The input is in range format (e.g. 1-2,4,7-10)")
-	PayoutCmd.Flags().BoolVarP(&simpleJson, "simple", "s", false,
+	PayoutCmd.Flags().StringVarP(&epochToQuery, "epoch", "e", "", epochRangeUsage)
+	PayoutCmd.PersistentFlags().BoolVarP(&simpleJson, "simple", "s", false,
 		"also print out votes information, print rewards only by default")
+	PayoutCmd.Flags().StringVarP(&manifestFile, "manifest", "m", "",
+		"JSON file listing the delegates to pay out in a single run, " +
+		"instead of DELEGATE_NAME and OPERATOR")
+	PayoutCmd.PersistentFlags().StringVarP(&recordFile, "record", "r", "",
+		"file recording the epochs paid out, used by since-last-paid")
+	PayoutCmd.PersistentFlags().BoolVar(&bucketDetail, "buckets", false,
+		"also print out each voter's buckets and their part of the reward")
+	PayoutCmd.PersistentFlags().IntVar(&voteSamples, "vote-samples", 1,
+		"split rewards by the votes averaged over up to N gravity chain heights " +
+		"between the epoch and the next one, votes at the start of the epoch by default")
 
-	if blockComm > 100 {
-		fmt.Println("valid value for block reward commission rate is up to 100")
-		os.Exit(2)
-	}
-	if epochComm > 100 {
-		fmt.Println("valid value for epoch reward commission rate is up to 100")
-		os.Exit(2)
-	}
-	if foundationComm > 100 {
-		fmt.Println("valid value for extra reward commission rate is up to 100")
-		os.Exit(2)
-	}
 }
@@ -0,0 +1,202 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+)
+
+// Delegate listed in a manifest. Commission rates default to the command
+// line flags, and addresses to the registration of the delegate, when omitted.
+type ManifestDelegate struct {
+	Name          string      `json:"name"`
+	Operator      string      `json:"operator,omitempty"`
+	RewardAddress string      `json:"reward,omitempty"`
+	Commission    *Commission `json:"commission,omitempty"`
+	// addresses the delegate votes itself with, see SelfStake
+	SelfVoters            []string `json:"selfvoters,omitempty"`
+	RedistributeSelfVotes bool     `json:"redistributeselfvotes,omitempty"`
+}
+
+// Manifest of the delegates paid out in a single run, e.g.
+//   {"delegates": [
+//       {"name": "delegate1", "operator": "io1...",
+//        "commission": {"block": 100, "foundation": 100, "epoch": 90}},
+//       {"name": "delegate2", "operator": "operator2",
+//        "selfvoters": ["io1..."], "redistributeselfvotes": true}]}
+type Manifest struct {
+	Delegates []ManifestDelegate `json:"delegates"`
+}
+
+// Payout of a single delegate in the manifest
+type DelegatePayout struct {
+	Delegate  string            `json:"delegate"`
+	Operator  string            `json:"operator"`
+	Multisend []MultisendReward `json:"multisend"`
+	Shares    *RewardShares     `json:"rewardshares"`
+}
+
+// Payouts of all delegates in the manifest, and the multisend input paying
+// all of them at once
+type MultiPayout struct {
+	Delegates []DelegatePayout  `json:"delegates"`
+	Combined  []MultisendReward `json:"combined"`
+}
+
+// Debug string
+func (mp *MultiPayout) String() string {
+	mp_str, _ := json.MarshalIndent(mp, "", "    ")
+	return string(mp_str)
+}
+
+// read and validate manifest file
+func loadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %v", path, err)
+	}
+	if len(m.Delegates) == 0 {
+		return nil, fmt.Errorf("no delegate in manifest %s", path)
+	}
+	for i, d := range m.Delegates {
+		if d.Name == "" {
+			return nil, fmt.Errorf("delegate #%d in manifest %s needs a name", i, path)
+		}
+		if d.Commission == nil {
+			comm := defaultCommission()
+			m.Delegates[i].Commission = &comm
+			continue
+		}
+		if err := d.Commission.validate(); err != nil {
+			return nil, fmt.Errorf("delegate %s: %v", d.Name, err)
+		}
+	}
+	return &m, nil
+}
+
+// payoutManifest pays tokens out to all delegates of the manifest, returns
+// the output and whether the payer holds enough IOTX for it
+func payoutManifest(path string) (string, bool) {
+	m, err := loadManifest(path)
+	if err != nil {
+		panic(err)
+	}
+
+	payoutPolicy, err = loadPolicy(policyFile)
+	if err != nil {
+		panic(err)
+	}
+
+	names := make([][]byte, len(m.Delegates))
+	for i, d := range m.Delegates {
+		names[i] = delegateName(d.Name)
+	}
+	label, epochNums := runEpochs(epochToQuery, names...)
+
+	for i, d := range m.Delegates {
+		m.Delegates[i].Operator, m.Delegates[i].RewardAddress, err =
+			resolveDelegate(d.Name, d.Operator, d.RewardAddress, epochNums)
+		if err != nil {
+			panic(err)
+		}
+		if err := setSelfStake(d.Name, d.SelfVoters, d.RedistributeSelfVotes); err != nil {
+			panic(err)
+		}
+	}
+
+	config := newSnapshotConfig(m.Delegates, label, epochNums)
+	config.Manifest = true
+
+	checkpoints, err = openCheckpoints(checkpointDir, resume, config)
+	if err != nil {
+		panic(err)
+	}
+	recorder = newSnapshotRecorder(snapshotDir)
+	output, sent := payoutManifestEpochs(m, label, epochNums)
+	fmt.Println(sent)
+	rewardAddrs := make([]string, len(m.Delegates))
+	for i, d := range m.Delegates {
+		printUnclaimedReward(d.Name, d.RewardAddress)
+		rewardAddrs[i] = d.RewardAddress
+	}
+	funded := checkFunding(sent, rewardAddrs...)
+	delegates := make([]string, len(m.Delegates))
+	for i, d := range m.Delegates {
+		delegates[i] = d.Name
+	}
+	saveBatches(batchDir, sent, completedPayoutRecords(delegates, epochNums))
+
+	if err := recorder.save(config, output, sent); err != nil {
+		panic(err)
+	}
+
+	return output, funded
+}
+
+// calculate the reward shares of all delegates of a manifest with resolved
+// operator addresses, returns them along with the input for multisend
+func payoutManifestEpochs(m *Manifest, label string, epochNums []uint64) (string, string) {
+	results := make([]*RewardShares, len(m.Delegates))
+	for i := range results {
+		results[i] = NewRewardShares().SetEpochNum(label)
+	}
+
+	// go through delegates within an epoch so that they share the epoch meta
+	// and the votes fetched at its gravity chain height
+	for _, epoch := range epochNums {
+		fmt.Printf("epoch: %v\n", epoch)
+		for i, d := range m.Delegates {
+			reward := checkpointedEpochRewardShares(context.Background(),
+				d.Operator, delegateName(d.Name), epoch, *d.Commission)
+			results[i] = results[i].Combine(reward)
+		}
+	}
+
+	var mp MultiPayout
+	var voters []string
+	totals := make(map[string]*big.Int)
+	for i, d := range m.Delegates {
+		results[i] = payoutPolicy.apply(results[i])
+		dv, dr := voterPayouts(results[i])
+		mp.Delegates = append(mp.Delegates, DelegatePayout{
+			d.Name, d.Operator, multisend(dv, dr), results[i]})
+
+		// sum up the rewards of voters voting for several delegates
+		for j, voter := range dv {
+			if total, ok := totals[voter]; ok {
+				total.Add(total, dr[j])
+				continue
+			}
+			voters = append(voters, voter)
+			totals[voter] = new(big.Int).Set(dr[j])
+		}
+	}
+	var rewards []*big.Int
+	for _, voter := range voters {
+		rewards = append(rewards, totals[voter])
+	}
+	mp.Combined = multisend(voters, rewards)
+
+	s, _ := json.Marshal(mp.Combined)
+	return mp.String(), string(s)
+}
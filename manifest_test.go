@@ -0,0 +1,76 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadManifest(t *testing.T) {
+	blockCommOrig := blockComm
+	blockComm = 50
+
+	path := writeTempFile(t, `{"delegates": [
+		{"name": "delegate1", "operator": "io1operator1",
+		 "commission": {"block": 100, "foundation": 100, "epoch": 90}},
+		{"name": "delegate2", "operator": "io1operator2"}]}`)
+	defer os.Remove(path)
+
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Delegates) != 2 {
+		t.Fatalf("Expect 2 delegates, but actual obtained %v", len(m.Delegates))
+	}
+	if *m.Delegates[0].Commission != (Commission{100, 100, 90}) {
+		t.Fatalf("Expect commission {100, 100, 90}, but actual obtained %v", *m.Delegates[0].Commission)
+	}
+	if m.Delegates[1].Commission.Block != 50 {
+		t.Fatalf("Expect default block commission 50, but actual obtained %v", m.Delegates[1].Commission.Block)
+	}
+
+	invalid := writeTempFile(t, `{"delegates": [
+		{"name": "delegate1", "operator": "io1operator1",
+		 "commission": {"block": 101, "foundation": 100, "epoch": 90}}]}`)
+	defer os.Remove(invalid)
+	if _, err := loadManifest(invalid); err == nil {
+		t.Fatal("Expect error on commission rate above 100")
+	}
+
+	negative := writeTempFile(t, `{"delegates": [
+		{"name": "delegate1", "operator": "io1operator1",
+		 "commission": {"block": 100, "foundation": -10, "epoch": 90}}]}`)
+	defer os.Remove(negative)
+	if _, err := loadManifest(negative); err == nil {
+		t.Fatal("Expect error on negative commission rate")
+	}
+
+	blockComm = blockCommOrig
+}
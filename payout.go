@@ -18,16 +18,19 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"strings"
 	"strconv"
 	"fmt"
 	"math/big"
-	"bytes"
+	"time"
 
-	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
-	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/bc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/iotexproject/iotex-address/address"
 	"github.com/iotexproject/iotex-core/cli/ioctl/util"
 	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-core/protogen/iotextypes"
 	"github.com/iotexproject/iotex-election/committee"
 )
 
@@ -51,67 +54,42 @@ var CommitteeConfig committee.Config = committee.Config{
 	false, // SkipManifiedCandidate    bool
 }
 
-var epochResponse *iotexapi.GetEpochMetaResponse
-
-// get voter's votes
-func getVotes(delegate []byte, height uint64) (map[string]*big.Int, bool, *big.Int, *big.Int) {
-	comm, err := committee.NewCommittee(nil, CommitteeConfig)
-	if err != nil {
-		panic(err)
+// get the votes at a gravity chain height, shared by all delegates
+func fetchVoteSnapshot(ctx context.Context, height uint64) *VoteSnapshot {
+	if v := voteSnapshots.get(height); v != nil {
+		return v.(*VoteSnapshot)
+	}
+	if offline {
+		panic(fmt.Errorf("votes at gravity height %d not available offline", height))
 	}
-	result, err := comm.FetchResultByHeight(height)
+	result, err := session.electionResult(ctx, height)
 	if err != nil {
 		panic(err)
 	}
+	vs := newVoteSnapshot(height, result)
+	voteSnapshots.put(height, vs)
+	return vs
+}
 
+// get voter's votes
+func getVotes(ctx context.Context, delegate []byte, height uint64) (map[string]*big.Int, *big.Int, *big.Int) {
+	return tallyVotes(fetchVoteSnapshot(ctx, height), delegate)
+}
+
+// get voter's votes from a snapshot
+func tallyVotes(vs *VoteSnapshot, delegate []byte) (map[string]*big.Int, *big.Int, *big.Int) {
 	delegateVotes := new(big.Int)
 	bps := make(map[string]*big.Int)
 
-	// whether delegate is elected
-	isElected := false
-	rank := 0
-	robotVotes, _ := new(big.Int).SetString("100000000000000000000000000", 10)
-	smallRobotVotes, _ := new(big.Int).SetString("100000000000000000000", 10)
-	twoMillionVotes, _ := new(big.Int).SetString("2000000000000000000000000", 10)
-	selfVotes, _ := new(big.Int).SetString("1200000000000000000000000", 10)
 	total := new(big.Int)
-	for _, del := range result.Delegates() {
-		// delvote: total votes of the delegate
-		delvote := new(big.Int)
-		for _, vote := range result.VotesByDelegate(del.Name()) {
-			votes := vote.WeightedAmount()
-			delvote = delvote.Add(delvote, votes)
-		}
-
-		// filter out large robot's votes
-		if delvote.Cmp(robotVotes) == 0 {
-			continue
-		}
-		// filter out small robot's votes
-		if delvote.Cmp(smallRobotVotes) == 0 {
-			continue
-		}
-		// filter out votes < 2,000,000
-		if delvote.Cmp(twoMillionVotes) < 0 {
-			continue
-		}
-		// filter out votes with self-votes < 1,200,000
-		if del.SelfStakingTokens().Cmp(selfVotes) < 0 {
-			continue
-		}
-		total = total.Add(total, delvote)
-
-		// elected if delegate is within top 36 candidates, excludign robots
-		if bytes.Equal(delegate, del.Name()) && rank < 36 {
-			isElected = true
-		}
-		rank = rank + 1
+	for _, del := range vs.candidates() {
+		total = total.Add(total, del.totalVotes())
 	}
 
 	// delegate vote distribution
-	for _, vote := range result.VotesByDelegate(delegate) {
-		ethAddr := hex.EncodeToString(vote.Voter()) // []byte
-		votes := vote.WeightedAmount()              // *big.Int
+	for _, vote := range vs.votesByDelegate(delegate) {
+		ethAddr := vote.Voter       // hex string
+		votes := vote.weighted()    // *big.Int
 		_, ok := bps[ethAddr]
 		if ok {
 			// Already have this eth addr, need to combine the votes
@@ -122,16 +100,27 @@ func getVotes(delegate []byte, height uint64) (map[string]*big.Int, bool, *big.I
 		delegateVotes = delegateVotes.Add(delegateVotes, votes)
 	}
 
-	return bps, isElected, delegateVotes, total
+	return bps, delegateVotes, total
 }
 
 // get current epoch
-func currentEpochNum() uint64 {
-	chainMeta, err := bc.GetChainMeta()
+func currentEpochNum(ctx context.Context) uint64 {
+	return chainMeta(ctx).GetEpoch().GetNum()
+}
+
+// get the height and current epoch of the chain
+func chainMeta(ctx context.Context) *iotextypes.ChainMeta {
+	cli, err := session.client()
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := apiContext(ctx)
+	defer cancel()
+	response, err := cli.GetChainMeta(ctx, &iotexapi.GetChainMetaRequest{})
 	if err != nil {
 		panic(err)
 	}
-	return chainMeta.Epoch.Num
+	return response.GetChainMeta()
 }
 
 // calculate rewards
@@ -166,52 +155,79 @@ func calculateReward(blks uint64, elected bool, votes *big.Int, total *big.Int)
 	return reward
 }
 
-func getEpochResponse(epoch_num uint64) {
-	conn, err := util.ConnectToEndpoint(false)
+// get epoch meta data, shared with other delegates once the epoch is completed
+func getEpochResponse(ctx context.Context, epoch_num uint64) *iotexapi.GetEpochMetaResponse {
+	if v := epochMetas.get(epoch_num); v != nil {
+		return v.(*iotexapi.GetEpochMetaResponse)
+	}
+	if offline {
+		panic(fmt.Errorf("meta of epoch %d not available offline", epoch_num))
+	}
+	cli, err := session.client()
 	if err != nil {
 		panic(err)
 	}
-	defer conn.Close()
-	cli := iotexapi.NewAPIServiceClient(conn)
 	request := &iotexapi.GetEpochMetaRequest{EpochNumber: epoch_num}
-	ctx := context.Background()
-	epochResponse, err = cli.GetEpochMeta(ctx, request)
+	ctx, cancel := apiContext(ctx)
+	defer cancel()
+	epochResponse, err := cli.GetEpochMeta(ctx, request)
 	if err != nil {
 		panic(err)
 	}
+	if epoch_num < latestEpoch(ctx) {
+		epochMetas.put(epoch_num, epochResponse)
+	}
+	return epochResponse
 }
 
 // get epoch data
-func epochNum() uint64 {
+func epochNum(epochResponse *iotexapi.GetEpochMetaResponse) uint64 {
 	return epochResponse.GetEpochData().GetNum()
 }
 
-func epochHeight() uint64 {
+func epochHeight(epochResponse *iotexapi.GetEpochMetaResponse) uint64 {
 	return epochResponse.GetEpochData().GetHeight()
 }
 
-func epochGravityHeight() uint64 {
+func epochGravityHeight(epochResponse *iotexapi.GetEpochMetaResponse) uint64 {
 	return epochResponse.GetEpochData().GetGravityChainStartHeight()
 }
 
-// get number of produced blocks
-func delegateProductivity(operator string) uint64 {
-	for _, bp := range epochResponse.GetBlockProducersInfo() {
-		if operator == bp.GetAddress() {
-			return bp.GetProduction()
-		}
+// get the time a block was produced
+func blockTime(ctx context.Context, height uint64) time.Time {
+	cli, err := session.client()
+	if err != nil {
+		panic(err)
 	}
-	return 0
+	request := &iotexapi.GetBlockMetasRequest{
+		Lookup: &iotexapi.GetBlockMetasRequest_ByIndex{
+			ByIndex: &iotexapi.GetBlockMetasByIndexRequest{Start: height, Count: 1},
+		},
+	}
+	ctx, cancel := apiContext(ctx)
+	defer cancel()
+	response, err := cli.GetBlockMetas(ctx, request)
+	if err != nil {
+		panic(err)
+	}
+	if len(response.GetBlkMetas()) == 0 {
+		panic(fmt.Errorf("block %d not found", height))
+	}
+	t, err := ptypes.Timestamp(response.GetBlkMetas()[0].GetTimestamp())
+	if err != nil {
+		panic(err)
+	}
+	return t
 }
 
-// whether the delegate was elected
-func isDelegateElected(operator string) bool {
+// get number of produced blocks
+func delegateProductivity(epochResponse *iotexapi.GetEpochMetaResponse, operator string) uint64 {
 	for _, bp := range epochResponse.GetBlockProducersInfo() {
 		if operator == bp.GetAddress() {
-			return true
+			return bp.GetProduction()
 		}
 	}
-	return false
+	return 0
 }
 
 // get delegate's name as byte array
@@ -224,84 +240,102 @@ func delegateName(delegate string) []byte {
 	}
 }
 
+// get voter's address in the hex format used as key of the votes distribution,
+// from either an io address or a 0x address
+func voterETHAddr(voter string) (string, error) {
+	if strings.HasPrefix(voter, "io") {
+		addr, err := address.FromString(voter)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(addr.Bytes()), nil
+	}
+	if !common.IsHexAddress(voter) {
+		return "", fmt.Errorf("invalid voter address %s", voter)
+	}
+	return hex.EncodeToString(common.HexToAddress(voter).Bytes()), nil
+}
+
 // populate reward shares for a single epoch
-func calculateEpochRewardShares(operator string, delegate []byte, epoch_num uint64) *RewardShares {
+func calculateEpochRewardShares(ctx context.Context, operator string, delegate []byte, epoch_num uint64, comm Commission) *RewardShares {
 	// get epoch response
-	getEpochResponse(epoch_num)
+	epochResponse := getEpochResponse(ctx, epoch_num)
 
 	// get gravity height
-	gravity_height := epochGravityHeight()
+	gravity_height := epochGravityHeight(epochResponse)
 
 	// get number of produced blocks
-	blocks := delegateProductivity(operator)
+	blocks := delegateProductivity(epochResponse, operator)
 
 	// get delegate's votes
-	votes_distribution, elected, delegate_votes, total_votes := getVotes(delegate, gravity_height)
+	votes_distribution, delegate_votes, total_votes := getVotes(ctx, delegate, gravity_height)
+	vs := fetchVoteSnapshot(ctx, gravity_height)
+	recorder.add(epochResponse, vs)
+
+	// the chain decides who is a consensus delegate, the ranking computed
+	// from the votes is only checked against it
+	var notes []string
+	status := delegateStatus(epochResponse, vs, operator, delegate)
+	if mismatch := status.mismatch(epoch_num); mismatch != "" {
+		if strictElection {
+			panic(errors.New(mismatch))
+		}
+		notes = append(notes, mismatch)
+	}
 
 	// calculate reward
-	reward := calculateReward(blocks, elected, delegate_votes, total_votes)
+	reward := calculateReward(blocks, status.Consensus, delegate_votes, total_votes)
+	reward, productivity_notes := applyProductivityRules(reward, epochResponse, operator)
+	notes = append(notes, productivity_notes...)
+
+	// split the reward by the votes averaged across the epoch if sampling
+	shares_distribution, shares_total := votes_distribution, delegate_votes
+	if voteSamples > 1 {
+		shares_distribution, shares_total = sampleVotes(ctx, delegate, epoch_num, gravity_height)
+	}
+	self := selfStakeOf(delegate)
+	shares_distribution, shares_total = self.exclude(shares_distribution, shares_total)
 
 	// populate rewardshare structure
-	return NewRewardShares().
+	rs := NewRewardShares().
 		SetEpochNum(strconv.FormatUint(epoch_num, 10)).
 		SetProductivity(blocks).
 		SetTotalVotes(delegate_votes).
 		SetReward(reward).
-		CalculateShares(votes_distribution, delegate_votes, epoch_num)
-}
-
-// Generator for epoch range
-func epochRangeGen(epochs string) chan uint64 {
-	c := make(chan uint64)
-
-	// string parser for extracting epoch range
-	go func(input string) {
-		for _, part := range strings.Split(input, ",") {
-			if i := strings.Index(part[1:], "-"); i == -1 {
-				n, err := strconv.ParseUint(part, 10, 64)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				c <- n
-			} else {
-				n1, err := strconv.ParseUint(part[:i+1], 10, 64)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				n2, err := strconv.ParseUint(part[i+2:], 10, 64)
-				if err != nil {
-					fmt.Println(err)
-					break
-				}
-				if n2 < n1 {
-					fmt.Printf("Invalid range %d-%d\n", n1, n2)
-					break
-				}
-				for ii := n1; ii <= n2; ii++ {
-					c <- ii
-				}
-			}
-		}
-		close(c)
-	}(epochs)
-	return c
+		AddNotes(notes...).
+		CalculateSharesWithCommission(shares_distribution, shares_total, epoch_num, comm)
+	self.drop(rs)
+	if bucketDetail {
+		rs.SetBuckets(fetchVoteSnapshot(ctx, gravity_height).bucketsByVoter(delegate), epoch_num)
+	}
+	return rs
 }
 
-// populate reward shares for a range of epochs
-func calculateRewardShares(operator string, delegate []byte, epochs string) *RewardShares {
+// populate reward shares for a range of epochs, fails on an invalid range
+func calculateRewardShares(ctx context.Context, operator string, delegate []byte, epochs string, comm Commission) (*RewardShares, error) {
 	if epochs == "" {
-		return calculateEpochRewardShares(
-			operator, delegate, currentEpochNum())
+		return calculateEpochRewardShares(ctx,
+			operator, delegate, currentEpochNum(ctx), comm), nil
+	}
+
+	epochNums, err := resolveEpochs(ctx, epochs, delegate)
+	if err != nil {
+		return nil, err
 	}
+	return combineRewardShares(ctx, operator, delegate, epochs, epochNums, comm), nil
+}
 
-	// parse a range of epochs
+// populate reward shares for the given epochs, labelled as epochs. Stops
+// between epochs once ctx is done.
+func combineRewardShares(ctx context.Context, operator string, delegate []byte, epochs string, epochNums []uint64, comm Commission) *RewardShares {
 	result := NewRewardShares()
 	result.SetEpochNum(epochs)
-	for epoch := range epochRangeGen(epochs) {
+	for _, epoch := range epochNums {
+		if err := ctx.Err(); err != nil {
+			panic(err)
+		}
 		fmt.Printf("epoch: %v\n", epoch)
-		reward := calculateEpochRewardShares(operator, delegate, epoch)
+		reward := checkpointedEpochRewardShares(ctx, operator, delegate, epoch, comm)
 		result = result.Combine(reward)
 	}
 	return result
@@ -312,29 +346,82 @@ type MultisendReward struct {
 	Amount string `json:"amount"`
 }
 
-// payout pays tokens out to delegates on IoTeX blockchain
-func payout(delegate string, operator string) string {
-	// get operator's address
-	operator_addr, err := alias.Address(operator)
+// payout pays tokens out to delegates on IoTeX blockchain, returns the
+// output and whether the payer holds enough IOTX for it
+func payout(delegate string, operator string) (string, bool) {
+	// get delegate's name to 12-byte array
+	delegate_name := delegateName(delegate)
+	label, epochs := runEpochs(epochToQuery, delegate_name)
+
+	// get operator's and reward addresses
+	operator_addr, reward_addr, err := resolveDelegate(delegate, operator, rewardAddress, epochs)
 	if err != nil {
 		panic(err)
 	}
 
-	// get delegate's name to 12-byte array
-	delegate_name := delegateName(delegate)
+	payoutPolicy, err = loadPolicy(policyFile)
+	if err != nil {
+		panic(err)
+	}
+	if err := setSelfStake(delegate, selfVoters, redistributeSelfVotes); err != nil {
+		panic(err)
+	}
 
-	rs := calculateRewardShares(operator_addr, delegate_name, epochToQuery)
+	comm := defaultCommission()
+	config := newSnapshotConfig([]ManifestDelegate{{
+		Name:                  delegate,
+		Operator:              operator_addr,
+		RewardAddress:         reward_addr,
+		Commission:            &comm,
+		SelfVoters:            selfVoters,
+		RedistributeSelfVotes: redistributeSelfVotes,
+	}}, label, epochs)
+
+	checkpoints, err = openCheckpoints(checkpointDir, resume, config)
+	if err != nil {
+		panic(err)
+	}
+	recorder = newSnapshotRecorder(snapshotDir)
+	output, sent := payoutEpochs(delegate, operator_addr, label, epochs, comm)
+	fmt.Println(sent)
+	printUnclaimedReward(delegate, reward_addr)
+	funded := checkFunding(sent, reward_addr)
+	saveBatches(batchDir, sent, completedPayoutRecords([]string{delegate}, epochs))
+
+	if err := recorder.save(config, output, sent); err != nil {
+		panic(err)
+	}
 
-	// prepare input for multisend
-	//   https://member.iotex.io/multi-send
+	return output, funded
+}
+
+// label of the epochs in the output, the current epoch number if empty
+func epochLabel(epochs string, epochNums []uint64) string {
+	if epochs == "" {
+		return strconv.FormatUint(epochNums[0], 10)
+	}
+	return epochs
+}
+
+// calculate the reward shares of a delegate for the given epochs, returns
+// them along with the input for multisend
+func payoutEpochs(delegate string, operator string, label string, epochs []uint64, comm Commission) (string, string) {
+	rs := combineRewardShares(context.Background(), operator, delegateName(delegate), label, epochs, comm)
+	rs = payoutPolicy.apply(rs)
+	s, _ := json.Marshal(multisend(voterPayouts(rs)))
+	return rs.String(), string(s)
+}
+
+// total reward of each voter in rau, voters in 0x format
+func voterPayouts(rs *RewardShares) ([]string, []*big.Int) {
 	var voters []string
-	var rewards []string
+	var rewards []*big.Int
 
-	stradd := func(a string, b string, c string) string {
+	stradd := func(a string, b string, c string) *big.Int {
 		aa, _ := new(big.Int).SetString(a, 10)
 		bb, _ := new(big.Int).SetString(b, 10)
 		cc, _ := new(big.Int).SetString(c, 10)
-		return cc.Add(aa.Add(aa, bb), cc).Text(10)
+		return cc.Add(aa.Add(aa, bb), cc)
 	}
 
 	for _, share := range rs.Shares {
@@ -344,15 +431,16 @@ func payout(delegate string, operator string) string {
 						share.Reward.FoundationBonus,
 						share.Reward.EpochBonus))
 	}
+	return voters, rewards
+}
 
+// prepare input for multisend
+//   https://member.iotex.io/multi-send
+func multisend(voters []string, rewards []*big.Int) []MultisendReward {
 	var sent []MultisendReward
-	for i, a := range rewards {
-		amount, _ := new(big.Int).SetString(a, 10)
+	for i, amount := range rewards {
 		sent = append(sent, MultisendReward{voters[i],
 					util.RauToString(amount, util.IotxDecimalNum)})
 	}
-	s, _ := json.Marshal(sent)
-	fmt.Println(string(s))
-
-	return rs.String()
+	return sent
 }
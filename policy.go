@@ -0,0 +1,187 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+)
+
+// Flags
+var (
+	policyFile string
+)
+
+// policy applied to the payouts of the current run, nil if none
+var payoutPolicy *Policy
+
+func init() {
+	PayoutCmd.PersistentFlags().StringVar(&policyFile, "policy", "",
+		"JSON file with the loyalty rules applied to the payouts")
+}
+
+// fail if a policy is given to a command reporting rewards epoch by epoch,
+// which the loyalty rules over the paid out epochs cannot be split into
+func rejectPolicyFlag(command string) error {
+	if policyFile != "" {
+		return fmt.Errorf("%s does not apply the loyalty rules, --policy only applies to payouts", command)
+	}
+	return nil
+}
+
+// Reward multiplier of voters having voted at least Consecutive epochs in a row
+type LoyaltyTier struct {
+	Consecutive int   `json:"consecutive"`
+	Percent     int64 `json:"percent"`
+}
+
+// Loyalty rules applied to the rewards of the paid out epochs, e.g.
+//   {"minconsecutive": 24,
+//    "multipliers": [{"consecutive": 168, "percent": 110},
+//                    {"consecutive": 720, "percent": 120}],
+//    "redistribute": true}
+//
+// Streaks are counted within the epochs paid out by the run only, the payout
+// record does not keep the voters of earlier payouts. A tier is thus only
+// reached by runs of at least as many epochs, e.g. -e last:720 for 720.
+//
+// Voters who did not vote MinConsecutive epochs in a row forfeit their reward.
+// With Redistribute, forfeited rewards and multipliers are balanced among the
+// voters so that the total paid out is unchanged. Otherwise, or if no voter is
+// eligible, the delegate keeps forfeited rewards and pays the multipliers on top.
+type Policy struct {
+	MinConsecutive int           `json:"minconsecutive"`
+	Multipliers    []LoyaltyTier `json:"multipliers"`
+	Redistribute   bool          `json:"redistribute"`
+}
+
+// read and validate policy file, nil if path is empty
+func loadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if simpleJson {
+		return nil, fmt.Errorf("loyalty rules need the voted epochs, which -s leaves out")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", path, err)
+	}
+	for _, tier := range p.Multipliers {
+		if tier.Consecutive <= 0 || tier.Percent < 0 {
+			return nil, fmt.Errorf("invalid multiplier %+v in policy %s", tier, path)
+		}
+	}
+	return &p, nil
+}
+
+// longest run of consecutive epochs voted
+func consecutiveEpochs(votedPeriod []uint64) int {
+	epochs := append([]uint64(nil), votedPeriod...)
+	sort.Slice(epochs, func(i, j int) bool { return epochs[i] < epochs[j] })
+
+	longest, run := 0, 0
+	for i, epoch := range epochs {
+		switch {
+		case i > 0 && epoch == epochs[i-1]:
+			continue
+		case i > 0 && epoch == epochs[i-1]+1:
+			run++
+		default:
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// multiplier in percentage of a voter and the rule applied
+func (p *Policy) rule(votedPeriod []uint64) (int64, string) {
+	consecutive := consecutiveEpochs(votedPeriod)
+	if consecutive < p.MinConsecutive {
+		return 0, fmt.Sprintf("%d consecutive epochs, below minimum %d, forfeited",
+			consecutive, p.MinConsecutive)
+	}
+	percent, best := int64(100), 0
+	for _, tier := range p.Multipliers {
+		if consecutive >= tier.Consecutive && tier.Consecutive > best {
+			percent, best = tier.Percent, tier.Consecutive
+		}
+	}
+	return percent, fmt.Sprintf("%d consecutive epochs, %d%%", consecutive, percent)
+}
+
+// Apply the policy to the voters' rewards. A nil policy changes nothing.
+func (p *Policy) apply(rs *RewardShares) *RewardShares {
+	if p == nil {
+		return rs
+	}
+
+	percents := make([]*big.Int, len(rs.Shares))
+	for i, share := range rs.Shares {
+		percent, rule := p.rule(share.VotedPeriod)
+		percents[i] = big.NewInt(percent)
+		rs.Shares[i].Rule = rule
+	}
+
+	// apply the multipliers to one type of reward, and scale the voter's
+	// bucket rewards alike
+	adjust := func(get func(r *Reward) *string) {
+		pool := new(big.Int)
+		olds := make([]*big.Int, len(rs.Shares))
+		weights := make([]*big.Int, len(rs.Shares))
+		totalWeight := new(big.Int)
+		for i := range rs.Shares {
+			olds[i] = rau(*get(&rs.Shares[i].Reward))
+			pool.Add(pool, olds[i])
+			weights[i] = new(big.Int).Mul(olds[i], percents[i])
+			totalWeight.Add(totalWeight, weights[i])
+		}
+		for i := range rs.Shares {
+			v := weights[i]
+			if p.Redistribute && totalWeight.Sign() > 0 {
+				v = new(big.Int).Mul(pool, v)
+				v.Div(v, totalWeight)
+			} else {
+				v = new(big.Int).Div(v, big.NewInt(100))
+			}
+			*get(&rs.Shares[i].Reward) = v.Text(10)
+
+			buckets := append([]BucketShare(nil), rs.Shares[i].Buckets...)
+			for j := range buckets {
+				b := new(big.Int)
+				if olds[i].Sign() > 0 {
+					b.Mul(rau(*get(&buckets[j].Reward)), v)
+					b.Div(b, olds[i])
+				}
+				*get(&buckets[j].Reward) = b.Text(10)
+			}
+			rs.Shares[i].Buckets = buckets
+		}
+	}
+	adjust(func(r *Reward) *string { return &r.Block })
+	adjust(func(r *Reward) *string { return &r.FoundationBonus })
+	adjust(func(r *Reward) *string { return &r.EpochBonus })
+	return rs
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestConsecutiveEpochs(t *testing.T) {
+	tests := []struct {
+		epochs   []uint64
+		expected int
+	}{
+		{nil, 0},
+		{[]uint64{5}, 1},
+		{[]uint64{1, 2, 3, 5, 6}, 3},
+		{[]uint64{7, 6, 6, 5, 1}, 3},
+	}
+	for _, test := range tests {
+		if c := consecutiveEpochs(test.epochs); c != test.expected {
+			t.Errorf("Expect %v to have %d consecutive epochs, get %d", test.epochs, test.expected, c)
+		}
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	shares := func() *RewardShares {
+		rs := NewRewardShares()
+		rs.Shares = []Share{
+			{"io1", "a", nil, nil, []uint64{1, 2, 3, 4}, Reward{"100", "100", "100"}, nil, ""},
+			{"io2", "b", nil, nil, []uint64{1, 2}, Reward{"100", "100", "100"}, nil, ""},
+			{"io3", "c", nil, nil, []uint64{1, 3}, Reward{"100", "100", "100"}, nil, ""},
+		}
+		return rs
+	}
+	p := &Policy{MinConsecutive: 2, Multipliers: []LoyaltyTier{{2, 100}, {4, 300}}}
+
+	// forfeited reward kept and multiplier paid by the delegate
+	rs := p.apply(shares())
+	expected := []string{"300", "100", "0"}
+	for i, share := range rs.Shares {
+		if share.Reward.Block != expected[i] || share.Reward.EpochBonus != expected[i] {
+			t.Errorf("Expect voter %s to get %s, get %v (%s)",
+				share.ETHAddr, expected[i], share.Reward, share.Rule)
+		}
+	}
+	if rs.Shares[2].Rule != "1 consecutive epochs, below minimum 2, forfeited" {
+		t.Errorf("Unexpected rule %q", rs.Shares[2].Rule)
+	}
+	if rs.Shares[0].Rule != "4 consecutive epochs, 300%" {
+		t.Errorf("Unexpected rule %q", rs.Shares[0].Rule)
+	}
+
+	// total unchanged when redistributed
+	p.Redistribute = true
+	rs = p.apply(shares())
+	expected = []string{"225", "75", "0"}
+	for i, share := range rs.Shares {
+		if share.Reward.FoundationBonus != expected[i] {
+			t.Errorf("Expect voter %s to get %s, get %v", share.ETHAddr, expected[i], share.Reward)
+		}
+	}
+
+	// bucket rewards are scaled like the voter's
+	withBuckets := shares()
+	withBuckets.Shares[0].Buckets = []BucketShare{
+		{Epoch: 1, Reward: Reward{"60", "100", "30"}},
+		{Epoch: 2, Reward: Reward{"40", "0", "70"}},
+	}
+	rs = p.apply(withBuckets)
+	buckets := []Reward{{"135", "225", "67"}, {"90", "0", "157"}}
+	for i, b := range rs.Shares[0].Buckets {
+		if b.Reward != buckets[i] {
+			t.Errorf("Expect bucket reward %v, get %v", buckets[i], b.Reward)
+		}
+	}
+
+	var nilPolicy *Policy
+	if rs := nilPolicy.apply(shares()); rs.Shares[2].Reward.Block != "100" {
+		t.Errorf("Expect no policy to keep rewards, get %v", rs.Shares[2].Reward)
+	}
+}
+
+func TestPolicyFlagRejected(t *testing.T) {
+	defer func(file string) { policyFile = file }(policyFile)
+
+	for _, args := range [][]string{
+		{"voter", "0x45831656370acf0b345cc25558dc9b3b1424ddc3", "-d", "delegate1:" + testOperator,
+			"--policy", "policy.json"},
+		{"serve", "--policy", "policy.json"},
+	} {
+		policyFile = ""
+		PayoutCmd.SetArgs(args)
+		if err := PayoutCmd.Execute(); err == nil {
+			t.Errorf("Expect error on --policy %v", args)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+// Flags
+var (
+	productivityThreshold uint64
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().Uint64Var(&productivityThreshold, "productivity-threshold", 0,
+		"percentage of the expected blocks below which the chain grants no epoch bonus, "+
+			"set it to the chain's threshold, never by default")
+}
+
+// Productivity settings of a run, recorded in snapshots
+type ProductivityRules struct {
+	Threshold uint64 `json:"threshold"`
+}
+
+// expected number of blocks produced by a delegate in an epoch, 0 if the
+// delegate was not a block producer. Like the chain, the blocks of the epoch
+// are divided by the active block producers and whoever else produced a block.
+func expectedProduction(epochResponse *iotexapi.GetEpochMetaResponse, operator string) uint64 {
+	var producers uint64
+	isProducer := false
+	for _, bp := range epochResponse.GetBlockProducersInfo() {
+		if bp.GetActive() || bp.GetProduction() > 0 {
+			producers++
+			if bp.GetAddress() == operator {
+				isProducer = true
+			}
+		}
+	}
+	if !isProducer {
+		return 0
+	}
+	return epochResponse.GetTotalBlocks() / producers
+}
+
+// whether a delegate produced less than productivityThreshold percent of its
+// expected blocks
+func underProduced(epochResponse *iotexapi.GetEpochMetaResponse, operator string) bool {
+	expected := expectedProduction(epochResponse, operator)
+	produced := delegateProductivity(epochResponse, operator)
+	return expected > 0 && produced*100/expected < productivityThreshold
+}
+
+// remove the epoch bonus of an under-producing delegate like the chain, which
+// still grants it the block reward and the foundation bonus. Returns the
+// reduced reward and the explanation of the reduction.
+//
+// Probation cannot be applied: the epoch meta of the v0.5.0 API only reports
+// the votes, activeness and production of each block producer, and the chain
+// has no probation list to read. An under-producing epoch, after which a
+// chain with probation would reduce the next rewards, is flagged as such.
+func applyProductivityRules(reward Reward, epochResponse *iotexapi.GetEpochMetaResponse, operator string) (Reward, []string) {
+	var notes []string
+	if underProduced(epochResponse, operator) {
+		expected := expectedProduction(epochResponse, operator)
+		produced := delegateProductivity(epochResponse, operator)
+		notes = append(notes, fmt.Sprintf(
+			"epoch %d: produced %d of %d expected blocks (%d%%), below %d%%, no epoch bonus"+
+				", probation is not reported by the chain API and not applied",
+			epochNum(epochResponse), produced, expected, produced*100/expected, productivityThreshold))
+		reward.EpochBonus = "0"
+	}
+	return reward, notes
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+func TestProductivityRules(t *testing.T) {
+	thresholdOrig := productivityThreshold
+	defer func() { productivityThreshold = thresholdOrig }()
+	productivityThreshold = 85
+
+	// 2 active producers sharing 30 blocks, 15 expected each
+	meta := func(produced uint64) *iotexapi.GetEpochMetaResponse {
+		m := testEpochMeta(10, 7500000)
+		m.TotalBlocks = 30
+		m.BlockProducersInfo[0].Production = produced
+		m.BlockProducersInfo = append(m.BlockProducersInfo,
+			&iotexapi.BlockProducerInfo{Address: "io1other", Active: true, Production: 30 - produced})
+		return m
+	}
+	reward := Reward{"100", "80", "1000"}
+
+	if expected := expectedProduction(meta(15), testOperator); expected != 15 {
+		t.Fatalf("Expect 15 blocks expected, get %d", expected)
+	}
+
+	r, notes := applyProductivityRules(reward, meta(13), testOperator)
+	if r != reward || len(notes) != 0 {
+		t.Errorf("Expect full reward at 86%%, get %v %v", r, notes)
+	}
+
+	r, notes = applyProductivityRules(reward, meta(12), testOperator)
+	if r != (Reward{"100", "80", "0"}) || len(notes) != 1 {
+		t.Errorf("Expect block reward and foundation bonus only at 80%%, get %v %v", r, notes)
+	}
+	if notes[0] != "epoch 10: produced 12 of 15 expected blocks (80%), below 85%, no epoch bonus"+
+		", probation is not reported by the chain API and not applied" {
+		t.Errorf("Unexpected note %q", notes[0])
+	}
+
+	// an inactive delegate producing blocks counts as a producer, like on chain
+	m := meta(10)
+	m.BlockProducersInfo = append(m.BlockProducersInfo,
+		&iotexapi.BlockProducerInfo{Address: "io1standby", Production: 0})
+	if expected := expectedProduction(m, testOperator); expected != 15 {
+		t.Errorf("Expect idle standby delegates not counted, get %d", expected)
+	}
+	m.BlockProducersInfo[2].Production = 3
+	if expected := expectedProduction(m, testOperator); expected != 10 {
+		t.Errorf("Expect 10 blocks expected of 3 producers, get %d", expected)
+	}
+
+	productivityThreshold = 0
+	if r, notes := applyProductivityRules(reward, meta(0), testOperator); r != reward || len(notes) != 0 {
+		t.Errorf("Expect no reduction by default, get %v %v", r, notes)
+	}
+}
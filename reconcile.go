@@ -0,0 +1,332 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-core/protogen/iotextypes"
+	"github.com/spf13/cobra"
+)
+
+// status of a payout, a batch or a recipient
+const (
+	paymentComplete = "complete"
+	paymentPartial  = "partial"
+	paymentUnpaid   = "unpaid"
+	paymentShort    = "short"
+	paymentOver     = "over"
+)
+
+// receipt status of a successful action
+const receiptSuccess = 1
+
+// topic of the event emitted by the multisend contract for each recipient,
+//   event Transfer(address recipient, uint amount)
+var multisendTransferTopic = crypto.Keccak256([]byte("Transfer(address,uint256)"))
+
+// Flags
+var (
+	receiptInterval     time.Duration
+	receiptTimeout      time.Duration
+	reconcileRecordFile string
+	multisendContract   string
+)
+
+var ReconcileCmd = &cobra.Command{
+	Use:   "reconcile BATCH_DIR|MULTISEND_FILE ACTION_HASH [ACTION_HASH...] --multisend-contract CONTRACT",
+	Short: "Checks that the multisend actions paid every recipient the expected amount",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		r, err := reconcile(args[0], args[1:])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Print(r.String())
+		if r.Status != paymentComplete {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ReconcileCmd.Flags().DurationVar(&receiptInterval, "interval", 10*time.Second,
+		"interval between two polls of a receipt")
+	ReconcileCmd.Flags().DurationVar(&receiptTimeout, "timeout", 5*time.Minute,
+		"how long to wait for a receipt")
+	ReconcileCmd.Flags().StringVar(&reconcileRecordFile, "reconcile-record", "iotex_payout.reconcile",
+		"file recording the status of each reconciled payout")
+	ReconcileCmd.Flags().StringVar(&multisendContract, "multisend-contract", "",
+		"alias or address of the multisend contract, only its transfers are counted")
+
+	PayoutCmd.AddCommand(ReconcileCmd)
+}
+
+// A recipient of a payout
+type RecipientPayment struct {
+	Recipient string `json:"recipient"`
+	// amounts in IOTX
+	Expected string `json:"expected"`
+	Received string `json:"received"`
+	Status   string `json:"status"`
+}
+
+type BatchPayment struct {
+	File   string `json:"file"`
+	Status string `json:"status"`
+}
+
+// Result of reconciling a payout with its actions
+type ReconcileReport struct {
+	Source string   `json:"source"`
+	Hashes []string `json:"hashes"`
+	// actions without a receipt yet, whose transfers are not counted
+	Pending    []string           `json:"pending,omitempty"`
+	Status     string             `json:"status"`
+	Expected   string             `json:"expected"`
+	Received   string             `json:"received"`
+	Batches    []BatchPayment     `json:"batches"`
+	Recipients []RecipientPayment `json:"recipients"`
+	Time       time.Time          `json:"time"`
+}
+
+// expected recipients of each batch of a batch directory, or of a single
+// multisend file, and the records of the payout
+func loadPayments(source string) ([]string, [][]MultisendReward, []PayoutRecord, error) {
+	var files []string
+	var records []PayoutRecord
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		m, err := loadBatchManifest(source)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, b := range m.Batches {
+			files = append(files, filepath.Join(source, b.File))
+		}
+		records = m.Records
+	} else {
+		files = []string{source}
+	}
+
+	var batches [][]MultisendReward
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var batch []MultisendReward
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid multisend input %s: %v", file, err)
+		}
+		batches = append(batches, batch)
+	}
+	return files, batches, records, nil
+}
+
+// wait for the receipt of an action
+func waitReceipt(cli iotexapi.APIServiceClient, hash string) (*iotextypes.Receipt, error) {
+	deadline := time.Now().Add(receiptTimeout)
+	for {
+		ctx, cancel := apiContext(context.Background())
+		response, err := cli.GetReceiptByAction(ctx,
+			&iotexapi.GetReceiptByActionRequest{ActionHash: hash})
+		cancel()
+		if err == nil {
+			return response.GetReceiptInfo().GetReceipt(), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no receipt of action %s: %v", hash, err)
+		}
+		time.Sleep(receiptInterval)
+	}
+}
+
+// amounts in rau received by each recipient of a multisend action, by
+// 0x address in lower case. A failed action transfers nothing, and events of
+// other contracts than the multisend one are ignored.
+func multisendTransfers(receipt *iotextypes.Receipt, contract string, received map[string]*big.Int) {
+	if receipt.GetStatus() != receiptSuccess {
+		return
+	}
+	for _, log := range receipt.GetLogs() {
+		if log.GetContractAddress() != contract {
+			continue
+		}
+		topics := log.GetTopics()
+		if len(topics) == 0 || !bytes.Equal(topics[0], multisendTransferTopic) || len(log.GetData()) != 64 {
+			continue
+		}
+		recipient := strings.ToLower(common.BytesToAddress(log.GetData()[:32]).Hex())
+		amount := new(big.Int).SetBytes(log.GetData()[32:])
+		if _, ok := received[recipient]; !ok {
+			received[recipient] = new(big.Int)
+		}
+		received[recipient].Add(received[recipient], amount)
+	}
+}
+
+// compare the received amounts with the batches
+func reconcilePayments(files []string, batches [][]MultisendReward, received map[string]*big.Int) (*ReconcileReport, error) {
+	iotx := func(rau *big.Int) string { return util.RauToString(rau, util.IotxDecimalNum) }
+	r := &ReconcileReport{Status: paymentComplete}
+	expectedTotal, receivedTotal := new(big.Int), new(big.Int)
+	for _, v := range received {
+		receivedTotal.Add(receivedTotal, v)
+	}
+
+	paid := 0
+	for i, batch := range batches {
+		complete, unpaid := 0, 0
+		for _, p := range batch {
+			expected, err := util.StringToRau(p.Amount, util.IotxDecimalNum)
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount %s to %s: %v", p.Amount, p.Recipient, err)
+			}
+			expectedTotal.Add(expectedTotal, expected)
+			got := received[strings.ToLower(p.Recipient)]
+			if got == nil {
+				got = new(big.Int)
+			}
+
+			rp := RecipientPayment{p.Recipient, iotx(expected), iotx(got), paymentComplete}
+			switch {
+			case got.Sign() == 0:
+				rp.Status = paymentUnpaid
+				unpaid++
+			case got.Cmp(expected) < 0:
+				rp.Status = paymentShort
+			case got.Cmp(expected) > 0:
+				rp.Status = paymentOver
+				complete++
+			default:
+				complete++
+			}
+			r.Recipients = append(r.Recipients, rp)
+		}
+
+		status := paymentPartial
+		switch {
+		case complete == len(batch):
+			status = paymentComplete
+			paid++
+		case unpaid == len(batch):
+			status = paymentUnpaid
+		}
+		r.Batches = append(r.Batches, BatchPayment{files[i], status})
+	}
+	if paid < len(batches) {
+		r.Status = paymentPartial
+	}
+	r.Expected = iotx(expectedTotal)
+	r.Received = iotx(receivedTotal)
+	return r, nil
+}
+
+// reconcile a payout with the actions sending it, and record the result.
+// Actions without a receipt are recorded as pending, and the payout is then
+// partial at best.
+func reconcile(source string, hashes []string) (*ReconcileReport, error) {
+	if multisendContract == "" {
+		return nil, fmt.Errorf("--multisend-contract is needed to tell the transfers of the payout")
+	}
+	contract, err := alias.Address(multisendContract)
+	if err != nil {
+		return nil, err
+	}
+	files, batches, records, err := loadPayments(source)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := session.client()
+	if err != nil {
+		return nil, err
+	}
+	received := make(map[string]*big.Int)
+	var pending []string
+	for _, hash := range hashes {
+		receipt, err := waitReceipt(cli, hash)
+		if err != nil {
+			fmt.Println(err)
+			pending = append(pending, hash)
+			continue
+		}
+		if receipt.GetStatus() != receiptSuccess {
+			fmt.Printf("action %s failed with status %d\n", hash, receipt.GetStatus())
+		}
+		multisendTransfers(receipt, contract, received)
+	}
+
+	r, err := reconcilePayments(files, batches, received)
+	if err != nil {
+		return nil, err
+	}
+	r.Source = source
+	r.Hashes = hashes
+	r.Pending = pending
+	if len(pending) > 0 {
+		r.Status = paymentPartial
+	}
+	r.Time = time.Now().UTC()
+	if err := appendRecord(reconcileRecordFile, r); err != nil {
+		return nil, err
+	}
+
+	// the epochs are only recorded as paid out once every batch is paid
+	if r.Status == paymentComplete && recordFile != "" {
+		for _, pr := range records {
+			pr.Time = r.Time
+			if err := appendPayoutRecord(recordFile, pr); err != nil {
+				return nil, err
+			}
+			fmt.Printf("%s: epochs %d-%d recorded as paid out\n", pr.Delegate, pr.FirstEpoch, pr.LastEpoch)
+		}
+	}
+	return r, nil
+}
+
+// Report
+func (r *ReconcileReport) String() string {
+	var buf bytes.Buffer
+	for _, b := range r.Batches {
+		fmt.Fprintf(&buf, "%s: %s\n", b.File, b.Status)
+	}
+	for _, p := range r.Recipients {
+		if p.Status != paymentComplete {
+			fmt.Fprintf(&buf, "%s %s: expected %s IOTX, received %s IOTX\n",
+				p.Recipient, p.Status, p.Expected, p.Received)
+		}
+	}
+	for _, hash := range r.Pending {
+		fmt.Fprintf(&buf, "%s: pending, no receipt\n", hash)
+	}
+	fmt.Fprintf(&buf, "%s: expected %s IOTX, received %s IOTX\n", r.Status, r.Expected, r.Received)
+	return buf.String()
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iotexproject/iotex-address/address"
+	"github.com/iotexproject/iotex-core/protogen/iotextypes"
+)
+
+// address of the multisend contract in the tests
+var testMultisendContract = func() string {
+	addr, _ := address.FromBytes(common.HexToAddress("0x0ddfc506136fb7c050cc2e9511eccd81b15e7426").Bytes())
+	return addr.String()
+}()
+
+// log of the multisend contract paying amount IOTX to recipient
+func testTransferLog(recipient string, amount int64) *iotextypes.Log {
+	iotx := new(big.Int).Mul(big.NewInt(amount), big.NewInt(1000000000000000000))
+	data := append(common.LeftPadBytes(common.HexToAddress(recipient).Bytes(), 32),
+		common.LeftPadBytes(iotx.Bytes(), 32)...)
+	return &iotextypes.Log{ContractAddress: testMultisendContract,
+		Topics: [][]byte{multisendTransferTopic}, Data: data}
+}
+
+func TestReconcilePayments(t *testing.T) {
+	const (
+		a = "0x45831656370acf0b345cc25558dc9b3b1424ddc3"
+		b = "0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c"
+		c = "0x0ddfc506136fb7c050cc2e9511eccd81b15e7426"
+	)
+	batches := [][]MultisendReward{{{a, "1"}, {b, "2"}}, {{c, "3"}}}
+
+	received := make(map[string]*big.Int)
+	multisendTransfers(&iotextypes.Receipt{Status: receiptSuccess, Logs: []*iotextypes.Log{
+		testTransferLog(a, 1), testTransferLog(b, 2),
+	}}, testMultisendContract, received)
+	// failed action transfers nothing
+	multisendTransfers(&iotextypes.Receipt{Status: 0, Logs: []*iotextypes.Log{
+		testTransferLog(c, 3),
+	}}, testMultisendContract, received)
+
+	r, err := reconcilePayments([]string{"batch-001.json", "batch-002.json"}, batches, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != paymentPartial || r.Expected != "6" || r.Received != "3" {
+		t.Errorf("Expect partial payout of 3 of 6 IOTX, get %s of %s", r.Received, r.Expected)
+	}
+	if r.Batches[0].Status != paymentComplete || r.Batches[1].Status != paymentUnpaid {
+		t.Errorf("Expect first batch complete and second unpaid, get %v", r.Batches)
+	}
+
+	// retried second batch
+	multisendTransfers(&iotextypes.Receipt{Status: receiptSuccess, Logs: []*iotextypes.Log{
+		testTransferLog(c, 3),
+	}}, testMultisendContract, received)
+	r, err = reconcilePayments([]string{"batch-001.json", "batch-002.json"}, batches, received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != paymentComplete {
+		t.Errorf("Expect complete payout, get %s", r.String())
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	const (
+		a = "0x45831656370acf0b345cc25558dc9b3b1424ddc3"
+		b = "0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c"
+	)
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	multisendFile := filepath.Join(dir, "multisend.json")
+	if err := ioutil.WriteFile(multisendFile, []byte(`[{"recipient":"`+a+`","amount":"1"},{"recipient":"`+b+`","amount":"2"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// another contract emitting the same event is not the payout
+	forged := testTransferLog(b, 2)
+	forged.ContractAddress = testOperator
+	s := testAPIServer()
+	s.receipts = map[string]*iotextypes.Receipt{
+		"hash1": {Status: receiptSuccess, Logs: []*iotextypes.Log{testTransferLog(a, 1), forged}},
+	}
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+	defer func(c, f string, timeout time.Duration) {
+		multisendContract, reconcileRecordFile, receiptTimeout = c, f, timeout
+	}(multisendContract, reconcileRecordFile, receiptTimeout)
+	multisendContract, receiptTimeout = "", 0
+	reconcileRecordFile = filepath.Join(dir, "reconcile")
+
+	if _, err := reconcile(multisendFile, []string{"hash1"}); err == nil {
+		t.Error("Expect error without the multisend contract")
+	}
+
+	// the receipt of hash2 is missing
+	multisendContract = testMultisendContract
+	var r *ReconcileReport
+	captureStdout(t, func() { r, err = reconcile(multisendFile, []string{"hash1", "hash2"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != paymentPartial || r.Received != "1" || len(r.Pending) != 1 || r.Pending[0] != "hash2" {
+		t.Errorf("Expect partial payout of 1 IOTX with hash2 pending, get %+v", r)
+	}
+	record, err := ioutil.ReadFile(reconcileRecordFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(record), `"pending":["hash2"]`) {
+		t.Errorf("Expect the pending action to be recorded, get %s", record)
+	}
+}
+
+func TestReconcileRecordsPayout(t *testing.T) {
+	const a = "0x45831656370acf0b345cc25558dc9b3b1424ddc3"
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := testAPIServer()
+	s.receipts = map[string]*iotextypes.Receipt{
+		"hash1": {Status: receiptSuccess, Logs: []*iotextypes.Log{testTransferLog(a, 1)}},
+	}
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+	defer func(c, f, r string, timeout time.Duration) {
+		multisendContract, reconcileRecordFile, recordFile, receiptTimeout = c, f, r, timeout
+	}(multisendContract, reconcileRecordFile, recordFile, receiptTimeout)
+	multisendContract, receiptTimeout = testMultisendContract, 0
+	reconcileRecordFile = filepath.Join(dir, "reconcile")
+	recordFile = filepath.Join(dir, "record")
+
+	// epoch 12 is still in progress
+	records := completedPayoutRecords([]string{"delegate1"}, []uint64{10, 11, 12})
+	if len(records) != 1 || records[0].FirstEpoch != 10 || records[0].LastEpoch != 11 {
+		t.Fatalf("Expect a record of epochs 10-11, get %+v", records)
+	}
+	if records := completedPayoutRecords([]string{"delegate1"}, []uint64{12}); records != nil {
+		t.Errorf("Expect no record of the current epoch, get %+v", records)
+	}
+
+	batches := filepath.Join(dir, "batches")
+	if _, err := writeBatches(batches, `[{"recipient":"`+a+`","amount":"2"}]`, records); err != nil {
+		t.Fatal(err)
+	}
+	// short payout, nothing recorded
+	captureStdout(t, func() { _, err = reconcile(batches, []string{"hash1"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid, err := lastPaidEpoch(recordFile, delegateName("delegate1")); err == nil {
+		t.Errorf("Expect no epoch recorded before the payout is complete, get %d", paid)
+	}
+
+	if _, err := writeBatches(batches, `[{"recipient":"`+a+`","amount":"1"}]`, records); err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() { _, err = reconcile(batches, []string{"hash1"}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paid, err := lastPaidEpoch(recordFile, delegateName("delegate1")); err != nil || paid != 11 {
+		t.Errorf("Expect epoch 11 recorded as last paid, get %d %v", paid, err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Record of the epochs paid out to the voters of a delegate. Records are
+// appended to the record file, one JSON object per line.
+type PayoutRecord struct {
+	Delegate   string    `json:"delegate"`
+	Epochs     []uint64  `json:"epochs"`
+	FirstEpoch uint64    `json:"firstepoch"`
+	LastEpoch  uint64    `json:"lastepoch"`
+	Time       time.Time `json:"time"`
+}
+
+// Allocate a record of the given epochs, sorted in ascending order
+func NewPayoutRecord(delegate string, epochs []uint64) PayoutRecord {
+	return PayoutRecord{
+		Delegate:   delegate,
+		Epochs:     epochs,
+		FirstEpoch: epochs[0],
+		LastEpoch:  epochs[len(epochs)-1],
+		Time:       time.Now().UTC(),
+	}
+}
+
+// Records of the completed epochs paid out to each delegate, nil if none.
+// They are kept with the batches of the payout until reconcile confirms it.
+func completedPayoutRecords(delegates []string, epochs []uint64) []PayoutRecord {
+	latest := latestEpoch(context.Background())
+	var completed []uint64
+	for _, epoch := range epochs {
+		if epoch < latest {
+			completed = append(completed, epoch)
+		}
+	}
+	if len(completed) == 0 {
+		return nil
+	}
+	var records []PayoutRecord
+	for _, delegate := range delegates {
+		records = append(records, NewPayoutRecord(delegate, completed))
+	}
+	return records
+}
+
+// append a record to the record file
+func appendPayoutRecord(path string, r PayoutRecord) error {
+	return appendRecord(path, r)
+}
+
+// append a record to a file as a line of JSON
+func appendRecord(path string, r interface{}) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(r)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// read all records of the record file, none if the file does not exist
+func readPayoutRecords(path string) ([]PayoutRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []PayoutRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r PayoutRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("invalid record at %s:%d: %v", path, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// last epoch paid out to the voters of the delegates. The delegates need to
+// have been paid out up to the same epoch.
+func lastPaidEpoch(path string, delegates ...[]byte) (uint64, error) {
+	if path == "" {
+		return 0, fmt.Errorf("since-last-paid needs a record file")
+	}
+	records, err := readPayoutRecords(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var last uint64
+	for i, delegate := range delegates {
+		var paid uint64
+		for _, r := range records {
+			if bytes.Equal(delegateName(r.Delegate), delegate) && r.LastEpoch > paid {
+				paid = r.LastEpoch
+			}
+		}
+		if paid == 0 {
+			return 0, fmt.Errorf("no payout of delegate %s recorded in %s",
+				bytes.TrimLeft(delegate, "\x00"), path)
+		}
+		if i > 0 && paid != last {
+			return 0, fmt.Errorf("delegates were last paid at different epochs %d and %d", last, paid)
+		}
+		last = paid
+	}
+	if len(delegates) == 0 {
+		return 0, fmt.Errorf("since-last-paid needs a delegate")
+	}
+	return last, nil
+}
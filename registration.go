@@ -0,0 +1,133 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+// ID of the rewarding protocol, as in iotex-core action/protocol/rewarding
+const rewardingProtocolID = "rewarding"
+
+// Flags
+var (
+	rewardAddress string
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().StringVar(&rewardAddress, "reward-address", "",
+		"reward address of the delegate, checked against its registration, looked up by default")
+}
+
+// resolve the operator and reward addresses of a delegate from its
+// registration at the gravity height of the last of the given epochs, the
+// latest epoch if none. Given addresses or aliases are checked against it,
+// empty ones are looked up.
+func resolveDelegate(delegate string, operator string, reward string, epochNums []uint64) (string, string, error) {
+	var err error
+	if operator != "" {
+		if operator, err = alias.Address(operator); err != nil {
+			return "", "", err
+		}
+	}
+	if reward != "" {
+		if reward, err = alias.Address(reward); err != nil {
+			return "", "", err
+		}
+	}
+	epoch := latestEpoch(context.Background())
+	if len(epochNums) > 0 {
+		epoch = epochNums[len(epochNums)-1]
+	}
+	vs := fetchVoteSnapshot(context.Background(), epochGravityHeight(getEpochResponse(context.Background(), epoch)))
+	return checkRegistration(vs, delegate, operator, reward)
+}
+
+// check the addresses of a delegate against its registration in the votes,
+// empty addresses are taken from the registration
+func checkRegistration(vs *VoteSnapshot, delegate string, operator string, reward string) (string, string, error) {
+	name := delegateName(delegate)
+	for _, d := range vs.Delegates {
+		if !bytes.Equal(d.name(), name) {
+			continue
+		}
+		if operator == "" {
+			operator = d.OperatorAddress
+		} else if operator != d.OperatorAddress {
+			return "", "", fmt.Errorf("delegate %s is registered with operator address %s, not %s",
+				delegate, d.OperatorAddress, operator)
+		}
+		if reward == "" {
+			reward = d.RewardAddress
+		} else if reward != d.RewardAddress {
+			return "", "", fmt.Errorf("delegate %s is registered with reward address %s, not %s",
+				delegate, d.RewardAddress, reward)
+		}
+		return operator, reward, nil
+	}
+	return "", "", fmt.Errorf("delegate %s is not registered at gravity chain height %d",
+		delegate, vs.Height)
+}
+
+// get the reward of an address not claimed from the rewarding protocol yet
+func unclaimedReward(addr string) *big.Int {
+	balance, err := readUnclaimedReward(addr)
+	if err != nil {
+		panic(err)
+	}
+	return balance
+}
+
+func readUnclaimedReward(addr string) (*big.Int, error) {
+	cli, err := session.client()
+	if err != nil {
+		return nil, err
+	}
+	request := &iotexapi.ReadStateRequest{
+		ProtocolID: []byte(rewardingProtocolID),
+		MethodName: []byte("UnclaimedBalance"),
+		Arguments:  [][]byte{[]byte(addr)},
+	}
+	ctx, cancel := apiContext(context.Background())
+	defer cancel()
+	response, err := cli.ReadState(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := new(big.Int).SetString(string(response.GetData()), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid unclaimed balance %q of %s", response.GetData(), addr)
+	}
+	return balance, nil
+}
+
+// print the unclaimed reward of the delegate's reward address. It is only
+// informative, a failure to read it is printed instead.
+func printUnclaimedReward(delegate string, reward string) {
+	balance, err := readUnclaimedReward(reward)
+	if err != nil {
+		fmt.Printf("%s: unclaimed reward of reward address %s unknown: %v\n", delegate, reward, err)
+		return
+	}
+	fmt.Printf("%s: %s IOTX unclaimed in reward address %s\n", delegate,
+		util.RauToString(balance, util.IotxDecimalNum), reward)
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRegistration(t *testing.T) {
+	vs := testVoteSnapshot(7500000)
+
+	operator, reward, err := checkRegistration(vs, "delegate1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operator != testOperator || reward != testRewardAddress {
+		t.Errorf("Expect registered addresses %s and %s, get %s and %s",
+			testOperator, testRewardAddress, operator, reward)
+	}
+
+	if _, _, err := checkRegistration(vs, "delegate1", testOperator, testRewardAddress); err != nil {
+		t.Errorf("Expect registered addresses to match, get %v", err)
+	}
+	if _, _, err := checkRegistration(vs, "delegate1", testRewardAddress, ""); err == nil {
+		t.Error("Expect error on reward address given as operator")
+	}
+	if _, _, err := checkRegistration(vs, "delegate1", "", testOperator); err == nil {
+		t.Error("Expect error on operator given as reward address")
+	}
+	if _, _, err := checkRegistration(vs, "delegate3", "", ""); err == nil {
+		t.Error("Expect error on unregistered delegate")
+	}
+}
+
+func TestResolveDelegate(t *testing.T) {
+	// the reward address of delegate1 changed in epoch 12
+	changed := testVoteSnapshot(7500200)
+	changed.Delegates[0].RewardAddress = testOperator
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{testVoteSnapshot(7500000), changed})
+	defer stop()
+
+	_, reward, err := resolveDelegate("delegate1", "", "", []uint64{10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reward != testRewardAddress {
+		t.Errorf("Expect reward address %s registered in epoch 10, get %s", testRewardAddress, reward)
+	}
+	if _, reward, _ := resolveDelegate("delegate1", "", "", nil); reward != testOperator {
+		t.Errorf("Expect reward address %s registered in the latest epoch, get %s", testOperator, reward)
+	}
+	if _, _, err := resolveDelegate("delegate1", "", testRewardAddress, nil); err == nil {
+		t.Error("Expect error on reward address not registered in the latest epoch")
+	}
+
+	// given addresses are still checked against the registration
+	operator, reward, err := resolveDelegate("delegate1", testOperator, testRewardAddress, []uint64{10})
+	if err != nil || operator != testOperator || reward != testRewardAddress {
+		t.Errorf("Expect given addresses, get %s %s %v", operator, reward, err)
+	}
+	if _, _, err := resolveDelegate("delegate3", testOperator, testRewardAddress, []uint64{10}); err == nil {
+		t.Error("Expect error on delegate not registered")
+	}
+	if _, _, err := resolveDelegate("delegate1", testRewardAddress, testRewardAddress, []uint64{10}); err == nil {
+		t.Error("Expect error on operator address not registered")
+	}
+}
+
+func TestPrintUnclaimedReward(t *testing.T) {
+	s := testAPIServer()
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+
+	out := captureStdout(t, func() { printUnclaimedReward("delegate1", testRewardAddress) })
+	if out != "delegate1: 150 IOTX unclaimed in reward address "+testRewardAddress+"\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+
+	s.unclaimed = nil
+	out = captureStdout(t, func() { printUnclaimedReward("delegate1", testRewardAddress) })
+	if !strings.HasPrefix(out, "delegate1: unclaimed reward of reward address "+testRewardAddress+" unknown") {
+		t.Errorf("Expect the failure to be printed, get %q", out)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iotexproject/iotex-election/committee"
+	"github.com/iotexproject/iotex-election/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Flags
+var (
+	retries         int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+	rateLimit       float64
+	circuitFailures int
+	circuitCooldown time.Duration
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().IntVar(&retries, "retries", 5,
+		"number of times a failed call to the chains is retried")
+	PayoutCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", time.Second,
+		"delay before the first retry, doubled for each next one, with jitter")
+	PayoutCmd.PersistentFlags().DurationVar(&retryMaxBackoff, "retry-max-backoff", 30*time.Second,
+		"maximum delay between two retries")
+	PayoutCmd.PersistentFlags().Float64Var(&rateLimit, "rate-limit", 0,
+		"maximum calls per second to each endpoint, a fetch of votes counting as one call "+
+			"to a gravity chain API, unlimited by default")
+	PayoutCmd.PersistentFlags().IntVar(&circuitFailures, "circuit-failures", 3,
+		"consecutive failures after which a gravity chain API is not called for --circuit-cooldown")
+	PayoutCmd.PersistentFlags().DurationVar(&circuitCooldown, "circuit-cooldown", time.Minute,
+		"time a failing gravity chain API is skipped before being tried again")
+	PayoutCmd.PersistentFlags().StringSliceVar(&CommitteeConfig.GravityChainAPIs, "gravity-chain-api",
+		CommitteeConfig.GravityChainAPIs, "URLs of the gravity chain APIs, used in order while they work")
+}
+
+// delay before retry number attempt, counted from 0: the backoff doubled for
+// each attempt up to the maximum, of which a random half is jitter
+func retryDelay(attempt int) time.Duration {
+	d := retryBackoff
+	for i := 0; i < attempt && d < retryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > retryMaxBackoff {
+		d = retryMaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// call until it succeeds, fails with an error that is not retryable, the
+// retries are exhausted or ctx is done
+func retry(ctx context.Context, call func() error, retryable func(error) bool) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || !retryable(err) || attempt >= retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay(attempt)):
+		}
+	}
+}
+
+// whether a failed call to the IoTeX API may succeed if made again
+func retryableCall(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// Spaces the calls to an endpoint by at least 1/--rate-limit seconds
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[string]*rateLimiter)
+)
+
+// rate limiter of an endpoint
+func endpointLimiter(endpoint string) *rateLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[endpoint]
+	if !ok {
+		l = &rateLimiter{}
+		limiters[endpoint] = l
+	}
+	return l
+}
+
+// wait for the turn of a call
+func (l *rateLimiter) wait() {
+	if rateLimit <= 0 {
+		return
+	}
+	interval := time.Duration(float64(time.Second) / rateLimit)
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(interval)
+	l.mu.Unlock()
+	time.Sleep(at.Sub(now))
+}
+
+// Stops calling an endpoint for --circuit-cooldown after --circuit-failures
+// consecutive failures. After the cooldown the circuit is half-open: a single
+// call is let through while the others are still refused, and the circuit
+// closes if it succeeds or opens again if it fails.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// whether the endpoint may be called
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+	if b.failures < circuitFailures {
+		return true
+	}
+	if b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= circuitFailures {
+		b.openUntil = time.Now().Add(circuitCooldown)
+	}
+}
+
+// create the committee fetching votes from a single gravity chain API
+var newCommittee = func(cfg committee.Config) (committee.Committee, error) {
+	return committee.NewCommittee(nil, cfg)
+}
+
+// A gravity chain API and the committee fetching votes through it
+type gravityEndpoint struct {
+	url     string
+	breaker circuitBreaker
+	mu      sync.Mutex
+	comm    committee.Committee
+}
+
+func newGravityEndpoints(urls []string) []*gravityEndpoint {
+	eps := make([]*gravityEndpoint, len(urls))
+	for i, url := range urls {
+		eps[i] = &gravityEndpoint{url: url}
+	}
+	return eps
+}
+
+// fetch the election result at a height through this API
+func (ep *gravityEndpoint) fetch(height uint64) (*types.ElectionResult, error) {
+	ep.mu.Lock()
+	if ep.comm == nil {
+		cfg := CommitteeConfig
+		cfg.GravityChainAPIs = []string{ep.url}
+		comm, err := newCommittee(cfg)
+		if err != nil {
+			ep.mu.Unlock()
+			return nil, err
+		}
+		ep.comm = comm
+	}
+	comm := ep.comm
+	ep.mu.Unlock()
+
+	endpointLimiter(ep.url).wait()
+	return comm.FetchResultByHeight(height)
+}
+
+// fetch the election result at a height from the first gravity chain API
+// that works, with retries. APIs whose circuit is open are skipped while
+// another one may be called, but are still called when none is left, so that
+// the circuits never defeat the retries.
+func fetchElectionResult(ctx context.Context, eps []*gravityEndpoint, height uint64) (*types.ElectionResult, error) {
+	var result *types.ElectionResult
+	err := retry(ctx, func() error {
+		var failures []string
+		fetch := func(ep *gravityEndpoint) bool {
+			r, err := ep.fetch(height)
+			if err == nil {
+				ep.breaker.success()
+				result = r
+				return true
+			}
+			ep.breaker.failure()
+			failures = append(failures, fmt.Sprintf("%s: %v", ep.url, err))
+			return false
+		}
+		for _, ep := range eps {
+			if ep.breaker.allow() && fetch(ep) {
+				return nil
+			}
+		}
+		if len(failures) == 0 {
+			for _, ep := range eps {
+				if fetch(ep) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("votes at gravity height %d:\n%s", height, strings.Join(failures, "\n"))
+	}, func(error) bool { return true })
+	return result, err
+}
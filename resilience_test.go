@@ -0,0 +1,232 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iotexproject/iotex-election/committee"
+	"github.com/iotexproject/iotex-election/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// restore the resilience flags after a test
+func saveResilienceFlags() func() {
+	r, b, m, l, f, c := retries, retryBackoff, retryMaxBackoff, rateLimit, circuitFailures, circuitCooldown
+	return func() {
+		retries, retryBackoff, retryMaxBackoff, rateLimit, circuitFailures, circuitCooldown = r, b, m, l, f, c
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	defer saveResilienceFlags()()
+	retryBackoff, retryMaxBackoff = time.Second, 10*time.Second
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if d := retryDelay(test.attempt); d < test.max/2 || d > test.max {
+				t.Errorf("Expect delay of attempt %d between %v and %v, get %v",
+					test.attempt, test.max/2, test.max, d)
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer saveResilienceFlags()()
+	retries, retryBackoff = 3, time.Millisecond
+	transient := status.Error(codes.Unavailable, "unavailable")
+
+	calls := 0
+	err := retry(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	}, retryableCall)
+	if err != nil || calls != 3 {
+		t.Errorf("Expect success at the third call, get %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = retry(context.Background(), func() error {
+		calls++
+		return transient
+	}, retryableCall)
+	if err != transient || calls != 4 {
+		t.Errorf("Expect failure after 1 call and 3 retries, get %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	notFound := status.Error(codes.NotFound, "not found")
+	err = retry(context.Background(), func() error {
+		calls++
+		return notFound
+	}, retryableCall)
+	if err != notFound || calls != 1 {
+		t.Errorf("Expect no retry of %v, get %d calls", notFound, calls)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	defer saveResilienceFlags()()
+	rateLimit = 100
+
+	var l rateLimiter
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait()
+	}
+	// the first call goes at once, the next ones 10ms apart
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expect 5 calls to take at least 40ms, get %v", elapsed)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	defer saveResilienceFlags()()
+	circuitFailures, circuitCooldown = 2, 20*time.Millisecond
+
+	var b circuitBreaker
+	b.failure()
+	if !b.allow() {
+		t.Error("Expect circuit to be closed after 1 failure")
+	}
+	b.failure()
+	if b.allow() {
+		t.Error("Expect circuit to be open after 2 failures")
+	}
+	time.Sleep(circuitCooldown)
+	if !b.allow() {
+		t.Error("Expect a call to be let through after the cooldown")
+	}
+	if b.allow() {
+		t.Error("Expect a single call to be let through while half-open")
+	}
+	b.failure()
+	if b.allow() {
+		t.Error("Expect circuit to open again when the call fails")
+	}
+	time.Sleep(circuitCooldown)
+	b.success()
+	b.failure()
+	if !b.allow() {
+		t.Error("Expect circuit to be closed after a success")
+	}
+}
+
+// committee failing a number of fetches first
+type fakeCommittee struct {
+	committee.Committee
+	failures int
+	fetched  int
+}
+
+func (c *fakeCommittee) FetchResultByHeight(height uint64) (*types.ElectionResult, error) {
+	c.fetched++
+	if c.failures > 0 {
+		c.failures--
+		return nil, errors.New("EOF")
+	}
+	return &types.ElectionResult{}, nil
+}
+
+func TestFetchElectionResult(t *testing.T) {
+	defer saveResilienceFlags()()
+	retries, retryBackoff, circuitFailures, circuitCooldown = 2, time.Millisecond, 2, time.Minute
+
+	comms := map[string]*fakeCommittee{
+		"https://primary": {failures: 100},
+		"https://backup":  {failures: 1},
+	}
+	newCommitteeOrig := newCommittee
+	defer func() { newCommittee = newCommitteeOrig }()
+	newCommittee = func(cfg committee.Config) (committee.Committee, error) {
+		return comms[cfg.GravityChainAPIs[0]], nil
+	}
+
+	eps := newGravityEndpoints([]string{"https://primary", "https://backup"})
+	// both fail at first, then the backup works
+	if _, err := fetchElectionResult(context.Background(), eps, 100); err != nil {
+		t.Fatal(err)
+	}
+	if comms["https://primary"].fetched != 2 || comms["https://backup"].fetched != 2 {
+		t.Errorf("Expect 2 fetches from each API, get %d and %d",
+			comms["https://primary"].fetched, comms["https://backup"].fetched)
+	}
+
+	// the primary API is skipped while its circuit is open
+	if _, err := fetchElectionResult(context.Background(), eps, 200); err != nil {
+		t.Fatal(err)
+	}
+	if comms["https://primary"].fetched != 2 || comms["https://backup"].fetched != 3 {
+		t.Errorf("Expect the primary API to be skipped, get %d fetches from it",
+			comms["https://primary"].fetched)
+	}
+
+	comms["https://backup"].failures = 100
+	if _, err := fetchElectionResult(context.Background(), eps, 300); err == nil {
+		t.Error("Expect error when every API fails")
+	}
+}
+
+func TestFetchElectionResultSingleAPI(t *testing.T) {
+	defer saveResilienceFlags()()
+	retries, retryBackoff, circuitFailures, circuitCooldown = 5, time.Millisecond, 2, time.Minute
+
+	comm := &fakeCommittee{failures: 4}
+	newCommitteeOrig := newCommittee
+	defer func() { newCommittee = newCommitteeOrig }()
+	newCommittee = func(cfg committee.Config) (committee.Committee, error) {
+		return comm, nil
+	}
+
+	// the open circuit of the only API does not stop the retries
+	eps := newGravityEndpoints([]string{"https://only"})
+	if _, err := fetchElectionResult(context.Background(), eps, 100); err != nil {
+		t.Fatal(err)
+	}
+	if comm.fetched != 5 {
+		t.Errorf("Expect 5 fetches, get %d", comm.fetched)
+	}
+}
+
+func TestInvokeRetry(t *testing.T) {
+	defer saveResilienceFlags()()
+	retries, retryBackoff = 3, time.Millisecond
+
+	s := testAPIServer()
+	s.unavailable = 2
+	stop := startFakeAPIServer(t, s, nil)
+	defer stop()
+	if num := currentEpochNum(context.Background()); num != 12 {
+		t.Errorf("Expect current epoch 12 after 2 retries, get %d", num)
+	}
+}
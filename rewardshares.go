@@ -16,9 +16,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/iotexproject/iotex-address/address"
 	"math/big"
+	"sort"
+	"time"
 )
 
 // reward type:
@@ -40,6 +43,45 @@ type Share struct {
 	Share   []uint64 `json:share`
 	VotedPeriod []uint64 `json:"voteperiod"`
 	Reward  Reward `json:"reward"`
+	Buckets []BucketShare `json:"buckets,omitempty"`
+	// loyalty rule applied to the reward, see Policy
+	Rule    string `json:"rule,omitempty"`
+}
+
+// a bucket voted by a voter in an epoch, and its part of the voter's reward
+type BucketShare struct {
+	Epoch          uint64    `json:"epoch"`
+	Amount         string    `json:"amount"`
+	WeightedAmount string    `json:"weighted"`
+	StartTime      time.Time `json:"start"`
+	Duration       string    `json:"duration"`
+	Decay          bool      `json:"decay"`
+	Reward         Reward    `json:"reward"`
+}
+
+// commission rates of each reward type, in percentage
+type Commission struct {
+	Block      int64 `json:"block"`
+	Foundation int64 `json:"foundation"`
+	Epoch      int64 `json:"epoch"`
+}
+
+// commission rates set by the command line flags
+func defaultCommission() Commission {
+	return Commission{blockComm, foundationComm, epochComm}
+}
+
+// check that the rates are percentages
+func (c Commission) validate() error {
+	for _, rate := range []struct {
+		name string
+		rate int64
+	}{{"block reward", c.Block}, {"foundation bonus", c.Foundation}, {"epoch bonus", c.Epoch}} {
+		if rate.rate < 0 || rate.rate > 100 {
+			return fmt.Errorf("valid value for %s commission rate is from 0 to 100, not %d", rate.name, rate.rate)
+		}
+	}
+	return nil
 }
 
 type RewardShares struct {
@@ -48,6 +90,8 @@ type RewardShares struct {
 	TotalVotes   []string `json:"votes"`
 	Reward       Reward   `json:"reward"`
 	Shares       []Share  `json:"shares"`
+	// reductions of the delegate's reward, see applyProductivityRules
+	Notes        []string `json:"notes,omitempty"`
 }
 
 func addReward(self Reward, other Reward) Reward {
@@ -81,6 +125,12 @@ func (rs *RewardShares) SetEpochNum(epoch string) *RewardShares {
 	return rs
 }
 
+// Add explanations of the reward
+func (rs *RewardShares) AddNotes(notes ...string) *RewardShares {
+	rs.Notes = append(rs.Notes, notes...)
+	return rs
+}
+
 // Set number of produced blocks
 func (rs *RewardShares) SetProductivity(prod uint64) *RewardShares {
 	rs.Productivity = prod
@@ -93,6 +143,7 @@ func (rs *RewardShares) Combine(other *RewardShares) *RewardShares {
 	rs.TotalVotes = append(rs.TotalVotes, other.TotalVotes...)
 
 	rs.Reward = addReward(rs.Reward, other.Reward)
+	rs.Notes = append(rs.Notes, other.Notes...)
 
 	var total []Share
 	for _, right := range other.Shares {
@@ -107,6 +158,7 @@ func (rs *RewardShares) Combine(other *RewardShares) *RewardShares {
 					rs.Shares[i].Share = append(left.Share, right.Share...)
 					rs.Shares[i].VotedPeriod = append(left.VotedPeriod, right.VotedPeriod...)
 				}
+				rs.Shares[i].Buckets = append(left.Buckets, right.Buckets...)
 				break
 			}
 		}
@@ -119,6 +171,34 @@ func (rs *RewardShares) Combine(other *RewardShares) *RewardShares {
 	return rs
 }
 
+// Deep copy of the rewardshares
+func (rs *RewardShares) Clone() *RewardShares {
+	clone := *rs
+	clone.TotalVotes = append([]string(nil), rs.TotalVotes...)
+	clone.Notes = append([]string(nil), rs.Notes...)
+	clone.Shares = nil
+	for _, share := range rs.Shares {
+		share.Votes = append([]string(nil), share.Votes...)
+		share.Share = append([]uint64(nil), share.Share...)
+		share.VotedPeriod = append([]uint64(nil), share.VotedPeriod...)
+		share.Buckets = append([]BucketShare(nil), share.Buckets...)
+		clone.Shares = append(clone.Shares, share)
+	}
+	return &clone
+}
+
+// Keep only the share of the given voter
+func (rs *RewardShares) FilterVoter(ethAddr string) *RewardShares {
+	var shares []Share
+	for _, share := range rs.Shares {
+		if share.ETHAddr == ethAddr {
+			shares = append(shares, share)
+		}
+	}
+	rs.Shares = shares
+	return rs
+}
+
 // Debug string
 func (rs *RewardShares) String() string {
 	rs_str, _ := json.MarshalIndent(rs, "", "    ")
@@ -127,9 +207,23 @@ func (rs *RewardShares) String() string {
 
 // Based on the obtained votes, calculate voter's shares
 func (rs *RewardShares) CalculateShares(bps map[string]*big.Int, total *big.Int, epoch uint64) *RewardShares {
-	// calculate each voter's meta info
+	return rs.CalculateSharesWithCommission(bps, total, epoch, defaultCommission())
+}
+
+// Based on the obtained votes, calculate voter's shares with the given
+// commission rates
+func (rs *RewardShares) CalculateSharesWithCommission(bps map[string]*big.Int, total *big.Int, epoch uint64, comm Commission) *RewardShares {
+	// calculate each voter's meta info, in the order of addresses so that
+	// the output is reproducible
+	var addrs []string
+	for addr := range bps {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
 	rs.Shares = nil
-	for addr, vote := range bps {
+	for _, addr := range addrs {
+		vote := bps[addr]
 		var share Share
 
 		hex_addr, _ := address.FromBytes(common.HexToAddress(addr).Bytes())
@@ -155,9 +249,9 @@ func (rs *RewardShares) CalculateShares(bps map[string]*big.Int, total *big.Int,
 		}
 
 		share.Reward = Reward{
-			discount(vote, total, rs.Reward.Block, blockComm),
-			discount(vote, total, rs.Reward.FoundationBonus, foundationComm),
-			discount(vote, total, rs.Reward.EpochBonus, epochComm),
+			discount(vote, total, rs.Reward.Block, comm.Block),
+			discount(vote, total, rs.Reward.FoundationBonus, comm.Foundation),
+			discount(vote, total, rs.Reward.EpochBonus, comm.Epoch),
 		}
 		rs.Shares = append(rs.Shares, share)
 	}
@@ -165,6 +259,43 @@ func (rs *RewardShares) CalculateShares(bps map[string]*big.Int, total *big.Int,
 	return rs
 }
 
+// Split each voter's reward among the buckets the voter voted with, in
+// proportion to their weighted amount
+func (rs *RewardShares) SetBuckets(buckets map[string][]Bucket, epoch uint64) *RewardShares {
+	for i, share := range rs.Shares {
+		votes := new(big.Int)
+		for _, bucket := range buckets[share.ETHAddr] {
+			votes.Add(votes, bucket.weighted())
+		}
+		if votes.Sign() == 0 {
+			continue
+		}
+
+		rs.Shares[i].Buckets = nil
+		for _, bucket := range buckets[share.ETHAddr] {
+			weighted := bucket.weighted()
+			split := func(value string) string {
+				v := new(big.Int).Mul(rau(value), weighted)
+				return v.Div(v, votes).Text(10)
+			}
+			rs.Shares[i].Buckets = append(rs.Shares[i].Buckets, BucketShare{
+				Epoch:          epoch,
+				Amount:         bucket.Amount,
+				WeightedAmount: bucket.WeightedAmount,
+				StartTime:      bucket.StartTime,
+				Duration:       bucket.Duration,
+				Decay:          bucket.Decay,
+				Reward: Reward{
+					split(share.Reward.Block),
+					split(share.Reward.FoundationBonus),
+					split(share.Reward.EpochBonus),
+				},
+			})
+		}
+	}
+	return rs
+}
+
 // Allocate new RewardShares
 func NewRewardShares() *RewardShares {
 	rs := new(RewardShares)
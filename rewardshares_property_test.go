@@ -0,0 +1,227 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// number of random inputs checked by each property
+const propertyChecks = 300
+
+// voters drawn by the generators, few enough that epochs share voters
+var propertyVoters = []string{
+	"45831656370acf0b345cc25558dc9b3b1424ddc3",
+	"7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c",
+	"0000000000000000000000000000000000000001",
+	"1111111111111111111111111111111111111111",
+	"a3c1b2d4e5f60718293a4b5c6d7e8f9012345678",
+	"ffffffffffffffffffffffffffffffffffffffff",
+}
+
+// random amount in [0, 10^digits)
+func randAmount(r *rand.Rand, digits int) *big.Int {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	return new(big.Int).Rand(r, max)
+}
+
+// Random input of CalculateSharesWithCommission: the votes of a delegate's
+// voters, the delegate's reward and commission rates
+type epochInput struct {
+	Epoch  uint64
+	Votes  map[string]*big.Int
+	Total  *big.Int
+	Reward Reward
+	Comm   Commission
+}
+
+func (epochInput) Generate(r *rand.Rand, size int) reflect.Value {
+	in := epochInput{
+		Epoch: uint64(r.Intn(10000)),
+		Votes: make(map[string]*big.Int),
+		Total: new(big.Int),
+		Reward: Reward{
+			randAmount(r, 1+r.Intn(24)).Text(10),
+			randAmount(r, 1+r.Intn(24)).Text(10),
+			randAmount(r, 1+r.Intn(24)).Text(10),
+		},
+		Comm: Commission{r.Int63n(101), r.Int63n(101), r.Int63n(101)},
+	}
+	for _, i := range r.Perm(len(propertyVoters))[:1+r.Intn(len(propertyVoters))] {
+		// at least 1 rau of votes so that the total is never 0
+		votes := randAmount(r, 1+r.Intn(27))
+		votes.Add(votes, big.NewInt(1))
+		in.Votes[propertyVoters[i]] = votes
+		in.Total.Add(in.Total, votes)
+	}
+	return reflect.ValueOf(in)
+}
+
+func (in epochInput) rewardShares() *RewardShares {
+	rs := NewRewardShares().SetEpochNum(fmt.Sprint(in.Epoch)).SetReward(in.Reward).SetTotalVotes(in.Total)
+	return rs.CalculateSharesWithCommission(in.Votes, in.Total, in.Epoch, in.Comm)
+}
+
+// check the rewards of each type against the reward of the delegate, and
+// return the first violated invariant
+func checkConservation(in epochInput, rs *RewardShares) error {
+	types := []struct {
+		name  string
+		value string
+		comm  int64
+		share func(Reward) string
+	}{
+		{"block", in.Reward.Block, in.Comm.Block, func(r Reward) string { return r.Block }},
+		{"foundation", in.Reward.FoundationBonus, in.Comm.Foundation, func(r Reward) string { return r.FoundationBonus }},
+		{"epoch", in.Reward.EpochBonus, in.Comm.Epoch, func(r Reward) string { return r.EpochBonus }},
+	}
+	for _, typ := range types {
+		distributable := new(big.Int).Mul(rau(typ.value), big.NewInt(100-typ.comm))
+		distributable.Div(distributable, big.NewInt(100))
+
+		sum := new(big.Int)
+		for _, share := range rs.Shares {
+			amount, ok := new(big.Int).SetString(typ.share(share.Reward), 10)
+			if !ok || amount.Sign() < 0 {
+				return fmt.Errorf("%s reward of %s is %s", typ.name, share.ETHAddr, typ.share(share.Reward))
+			}
+			sum.Add(sum, amount)
+		}
+		if sum.Cmp(distributable) > 0 {
+			return fmt.Errorf("voters get %s %s reward, more than %s", sum, typ.name, distributable)
+		}
+		// each voter loses less than 1 rau to rounding
+		if lost := new(big.Int).Sub(distributable, sum); lost.Cmp(big.NewInt(int64(len(rs.Shares)))) >= 0 {
+			return fmt.Errorf("voters get %s %s reward, %s less than %s", sum, typ.name, lost, distributable)
+		}
+	}
+	return nil
+}
+
+func TestCalculateSharesConservation(t *testing.T) {
+	simpleJsonOrig := simpleJson
+	defer func() { simpleJson = simpleJsonOrig }()
+	simpleJson = false
+
+	property := func(in epochInput) bool {
+		rs := in.rewardShares()
+		if len(rs.Shares) != len(in.Votes) {
+			t.Logf("%d shares for %d voters", len(rs.Shares), len(in.Votes))
+			return false
+		}
+		if err := checkConservation(in, rs); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: propertyChecks}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCalculateSharesNoCommission(t *testing.T) {
+	property := func(in epochInput) bool {
+		in.Comm = Commission{0, 0, 0}
+		rs := in.rewardShares()
+		if err := checkConservation(in, rs); err != nil {
+			t.Log(err)
+			return false
+		}
+		// everything but rounding reaches the voters
+		sum := new(big.Int)
+		for _, share := range rs.Shares {
+			sum.Add(sum, share.Reward.total())
+		}
+		lost := new(big.Int).Sub(in.Reward.total(), sum)
+		if lost.Sign() < 0 || lost.Cmp(big.NewInt(int64(3*len(rs.Shares)))) >= 0 {
+			t.Logf("voters get %s of %s", sum, in.Reward.total())
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: propertyChecks}); err != nil {
+		t.Error(err)
+	}
+}
+
+// Random epochs combined by the Combine properties
+type epochInputs [3]epochInput
+
+func (epochInputs) Generate(r *rand.Rand, size int) reflect.Value {
+	var ins epochInputs
+	for i := range ins {
+		ins[i] = epochInput{}.Generate(r, size).Interface().(epochInput)
+		ins[i].Epoch = uint64(i + 1)
+	}
+	return reflect.ValueOf(ins)
+}
+
+// total reward of each voter, and of the delegate under the key ""
+func voterTotals(rs *RewardShares) map[string]string {
+	totals := map[string]string{"": rs.Reward.total().Text(10)}
+	for _, share := range rs.Shares {
+		totals[share.ETHAddr] = share.Reward.total().Text(10)
+	}
+	return totals
+}
+
+func TestCombineAssociative(t *testing.T) {
+	property := func(ins epochInputs) bool {
+		a, b, c := ins[0].rewardShares(), ins[1].rewardShares(), ins[2].rewardShares()
+		left := a.Clone().Combine(b.Clone()).Combine(c.Clone())
+		right := a.Clone().Combine(b.Clone().Combine(c.Clone()))
+		if left.String() != right.String() {
+			t.Logf("(a+b)+c\n%s\na+(b+c)\n%s", left, right)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: propertyChecks}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCombineOrderIndependent(t *testing.T) {
+	property := func(ins epochInputs) bool {
+		var expected map[string]string
+		for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 0, 2}, {1, 2, 0}} {
+			rs := NewRewardShares()
+			for _, i := range order {
+				rs = rs.Combine(ins[i].rewardShares())
+			}
+			totals := voterTotals(rs)
+			if len(totals) != len(rs.Shares)+1 {
+				t.Logf("voter listed twice in %v", rs.Shares)
+				return false
+			}
+			if expected == nil {
+				expected = totals
+			} else if !reflect.DeepEqual(totals, expected) {
+				t.Logf("rewards %v in order %v, %v otherwise", totals, order, expected)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: propertyChecks}); err != nil {
+		t.Error(err)
+	}
+}
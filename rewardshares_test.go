@@ -188,13 +188,18 @@ func TestRewardShareString(t *testing.T) {
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{0},
 			/*Reward=*/Reward{"5", "5", "5"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}, Share{/*IOAddr=*/"io2",
 			/*ETHAddr=*/"yyy",
 			/*Votes=*/[]string{"5"},
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{0},
 			/*Reward=*/Reward{"5", "5", "5"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}},
+		/*Notes=*/nil,
 	}
 
 	const expected = `{"epochnum":"20","productivity":10,"votes":["10"],` +
@@ -229,13 +234,18 @@ func TestCombineReward(t *testing.T) {
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{0},
 			/*Reward=*/Reward{"5", "5", "5"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}, Share{/*IOAddr=*/"io2",
 			/*ETHAddr=*/"yyy",
 			/*Votes=*/[]string{"5"},
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{0},
 			/*Reward=*/Reward{"5", "5", "5"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}},
+		/*Notes=*/nil,
 	}
 	rs2 := RewardShares{
 		/*EpochNum=*/"",
@@ -251,13 +261,18 @@ func TestCombineReward(t *testing.T) {
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{1},
 			/*Reward=*/Reward{"10", "10", "10"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}, Share{/*IOAddr=*/"io3",
 			/*ETHAddr=*/"zzz",
 			/*Votes=*/[]string{"10"},
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{1},
 			/*Reward=*/Reward{"10", "10", "10"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}},
+		/*Notes=*/nil,
 	}
 	expected := RewardShares{
 		/*EpochNum=*/"",
@@ -273,19 +288,26 @@ func TestCombineReward(t *testing.T) {
 			/*Share=*/[]uint64{500, 500},
 			/*VotedPeriod=*/[]uint64{0, 1},
 			/*Reward=*/Reward{"15", "15", "15"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}, Share{/*IOAddr=*/"io2",
 			/*ETHAddr=*/"yyy",
 			/*Votes=*/[]string{"5"},
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{0},
 			/*Reward=*/Reward{"5", "5", "5"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}, Share{/*IOAddr=*/"io3",
 			/*ETHAddr=*/"zzz",
 			/*Votes=*/[]string{"10"},
 			/*Share=*/[]uint64{500},
 			/*VotedPeriod=*/[]uint64{1},
 			/*Reward=*/Reward{"10", "10", "10"},
+			/*Buckets=*/nil,
+			/*Rule=*/"",
 		}},
+		/*Notes=*/nil,
 	}
 
 	rs1.Combine(&rs2)
@@ -296,3 +318,89 @@ func TestCombineReward(t *testing.T) {
 			"%v", expected.String(), rs1.String())
 	}
 }
+
+func TestCloneAndFilterVoter(t *testing.T) {
+	rs := NewRewardShares().SetReward(Reward{"100", "1000", "10000"})
+	rs.Shares = []Share{Share{/*IOAddr=*/"io1",
+		/*ETHAddr=*/"xxx",
+		/*Votes=*/[]string{"5"},
+		/*Share=*/[]uint64{500},
+		/*VotedPeriod=*/[]uint64{0},
+		/*Reward=*/Reward{"5", "5", "5"},
+		/*Buckets=*/nil,
+		/*Rule=*/"",
+	}, Share{/*IOAddr=*/"io2",
+		/*ETHAddr=*/"yyy",
+		/*Votes=*/[]string{"5"},
+		/*Share=*/[]uint64{500},
+		/*VotedPeriod=*/[]uint64{0},
+		/*Reward=*/Reward{"5", "5", "5"},
+		/*Buckets=*/nil,
+		/*Rule=*/"",
+	}}
+
+	clone := rs.Clone()
+	clone.Shares[0].Votes[0] = "6"
+	if rs.Shares[0].Votes[0] != "5" {
+		t.Fatalf("Expect clone not to share votes, but original changed to %v", rs.Shares[0].Votes[0])
+	}
+
+	clone.FilterVoter("yyy")
+	if len(clone.Shares) != 1 || clone.Shares[0].ETHAddr != "yyy" {
+		t.Fatalf("Expect only voter yyy, but actual obtained %v", clone.Shares)
+	}
+	if len(rs.Shares) != 2 {
+		t.Fatalf("Expect original to keep 2 voters, but actual obtained %v", len(rs.Shares))
+	}
+}
+
+func TestSetBuckets(t *testing.T) {
+	rs := NewRewardShares()
+	rs.Shares = []Share{Share{/*IOAddr=*/"io1",
+		/*ETHAddr=*/"xxx",
+		/*Votes=*/nil,
+		/*Share=*/nil,
+		/*VotedPeriod=*/nil,
+		/*Reward=*/Reward{"30", "300", "3000"},
+		/*Buckets=*/nil,
+		/*Rule=*/"",
+	}}
+	rs.SetBuckets(map[string][]Bucket{"xxx": []Bucket{
+		{Voter: "xxx", Amount: "10", WeightedAmount: "10"},
+		{Voter: "xxx", Amount: "10", WeightedAmount: "20", Duration: "336h0m0s"},
+	}}, 10)
+
+	buckets := rs.Shares[0].Buckets
+	if len(buckets) != 2 {
+		t.Fatalf("Expect 2 buckets, but actual obtained %v", len(buckets))
+	}
+	if buckets[0].Reward != (Reward{"10", "100", "1000"}) ||
+	   buckets[1].Reward != (Reward{"20", "200", "2000"}) {
+		t.Fatalf("Expect rewards split 1:2 by weighted amount, but actual obtained %v and %v",
+			 buckets[0].Reward, buckets[1].Reward)
+	}
+	if buckets[1].Epoch != 10 || buckets[1].Duration != "336h0m0s" {
+		t.Fatalf("Expect bucket details kept, but actual obtained %v", buckets[1])
+	}
+}
+
+func TestCommissionFlags(t *testing.T) {
+	defer func(b, f, p int64) { blockComm, foundationComm, epochComm = b, f, p }(blockComm, foundationComm, epochComm)
+
+	for _, args := range [][]string{
+		{"delegate1", "-b", "101"},
+		{"delegate1", "-b=-1"},
+		{"delegate1", "-f=-10"},
+		{"delegate1", "-p", "150"},
+	} {
+		blockComm, foundationComm, epochComm = 100, 100, 100
+		PayoutCmd.SetArgs(args)
+		if err := PayoutCmd.Execute(); err == nil {
+			t.Errorf("Expect error on invalid commission rate %v", args)
+		}
+	}
+
+	if err := (Commission{0, 100, 50}).validate(); err != nil {
+		t.Errorf("Expect valid commission rates, get %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// Flags
+var (
+	selfVoters            []string
+	redistributeSelfVotes bool
+)
+
+func init() {
+	PayoutCmd.PersistentFlags().StringSliceVar(&selfVoters, "self-voter", nil,
+		"io or 0x address the delegate votes itself with, excluded from the payout, can be repeated")
+	PayoutCmd.PersistentFlags().BoolVar(&redistributeSelfVotes, "redistribute-self-votes", false,
+		"share the reward of the self voters among the other voters, kept by the delegate by default")
+}
+
+// Voter addresses of the delegate itself. Their reward is either kept by the
+// delegate or redistributed among the other voters.
+type SelfStake struct {
+	// voters in the hex format of Share.ETHAddr
+	Voters       map[string]bool
+	Redistribute bool
+}
+
+var (
+	selfStakesMu sync.RWMutex
+	// self stakes keyed by delegate name in hex
+	selfStakes = make(map[string]*SelfStake)
+)
+
+// fail if self voters are given to a command calculating the shares of any
+// delegate, which could not tell whose self voters they are
+func rejectSelfStakeFlags(command string) error {
+	if len(selfVoters) > 0 || redistributeSelfVotes {
+		return fmt.Errorf("%s does not exclude self voters, --self-voter and --redistribute-self-votes "+
+			"only apply to the payout of a delegate", command)
+	}
+	return nil
+}
+
+// register the self voters of a delegate, io or 0x addresses
+func setSelfStake(delegate string, voters []string, redistribute bool) error {
+	self := &SelfStake{make(map[string]bool), redistribute}
+	for _, voter := range voters {
+		ethAddr, err := voterETHAddr(voter)
+		if err != nil {
+			return err
+		}
+		self.Voters[ethAddr] = true
+	}
+
+	selfStakesMu.Lock()
+	defer selfStakesMu.Unlock()
+	key := hex.EncodeToString(delegateName(delegate))
+	if len(self.Voters) == 0 {
+		delete(selfStakes, key)
+		return nil
+	}
+	selfStakes[key] = self
+	return nil
+}
+
+// get the self stake of a delegate, nil if none
+func selfStakeOf(delegate []byte) *SelfStake {
+	selfStakesMu.RLock()
+	defer selfStakesMu.RUnlock()
+	return selfStakes[hex.EncodeToString(delegate)]
+}
+
+// remove the self voters from the votes distribution before calculating the
+// shares, if their reward is redistributed
+func (s *SelfStake) exclude(bps map[string]*big.Int, total *big.Int) (map[string]*big.Int, *big.Int) {
+	if s == nil || !s.Redistribute {
+		return bps, total
+	}
+	others := make(map[string]*big.Int)
+	remaining := new(big.Int).Set(total)
+	for voter, votes := range bps {
+		if s.Voters[voter] {
+			remaining.Sub(remaining, votes)
+			continue
+		}
+		others[voter] = votes
+	}
+	return others, remaining
+}
+
+// remove the shares of the self voters, so their reward is not paid out
+func (s *SelfStake) drop(rs *RewardShares) *RewardShares {
+	if s == nil {
+		return rs
+	}
+	var shares []Share
+	for _, share := range rs.Shares {
+		if !s.Voters[share.ETHAddr] {
+			shares = append(shares, share)
+		}
+	}
+	rs.Shares = shares
+	return rs
+}
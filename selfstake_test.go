@@ -0,0 +1,79 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSelfStake(t *testing.T) {
+	const self = "45831656370acf0b345cc25558dc9b3b1424ddc3"
+	const voter = "7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c"
+	bps := map[string]*big.Int{self: big.NewInt(5000), voter: big.NewInt(5000)}
+	total := big.NewInt(10000)
+	reward := Reward{"100", "1000", "10000"}
+	comm := Commission{0, 0, 0}
+
+	shares := func(s *SelfStake) *RewardShares {
+		bps, total := s.exclude(bps, total)
+		return s.drop(NewRewardShares().SetReward(reward).
+			CalculateSharesWithCommission(bps, total, 10, comm))
+	}
+
+	if err := setSelfStake("delegate1", []string{"0x" + self}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer setSelfStake("delegate1", nil, false)
+
+	// kept by the delegate
+	rs := shares(selfStakeOf(delegateName("delegate1")))
+	if len(rs.Shares) != 1 || rs.Shares[0].ETHAddr != voter {
+		t.Fatalf("Expect only voter %s, get %v", voter, rs.Shares)
+	}
+	if rs.Shares[0].Reward.EpochBonus != "5000" {
+		t.Errorf("Expect self votes' reward kept, get %v", rs.Shares[0].Reward)
+	}
+
+	// redistributed to the other voters
+	selfStakeOf(delegateName("delegate1")).Redistribute = true
+	rs = shares(selfStakeOf(delegateName("delegate1")))
+	if len(rs.Shares) != 1 || rs.Shares[0].Reward.EpochBonus != "10000" {
+		t.Errorf("Expect self votes' reward redistributed, get %v", rs.Shares)
+	}
+
+	// other delegates are not affected
+	if rs = shares(selfStakeOf(delegateName("delegate2"))); len(rs.Shares) != 2 {
+		t.Errorf("Expect 2 voters of delegate2, get %v", rs.Shares)
+	}
+}
+
+func TestSelfStakeFlagsRejected(t *testing.T) {
+	defer func(voters []string, redistribute bool) {
+		selfVoters, redistributeSelfVotes = voters, redistribute
+	}(selfVoters, redistributeSelfVotes)
+
+	for _, args := range [][]string{
+		{"voter", "0x45831656370acf0b345cc25558dc9b3b1424ddc3", "-d", "delegate1:" + testOperator,
+			"--self-voter", "0x45831656370acf0b345cc25558dc9b3b1424ddc3"},
+		{"serve", "--redistribute-self-votes"},
+	} {
+		selfVoters, redistributeSelfVotes = nil, false
+		PayoutCmd.SetArgs(args)
+		if err := PayoutCmd.Execute(); err == nil {
+			t.Errorf("Expect error on self stake flags %v", args)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/spf13/cobra"
+)
+
+// Flags
+var (
+	listenAddr     string
+	requestTimeout time.Duration
+	maxConcurrent  int
+	cacheSize      int
+)
+
+var ServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves voters' reward shares over HTTP/JSON",
+	Long: "Serves voters' reward shares over HTTP/JSON:\n" +
+		"  GET /delegates/DELEGATE_NAME/epochs/EPOCHS/shares?operator=OPERATOR\n" +
+		"  GET /voters/ADDRESS/rewards?delegate=DELEGATE_NAME&operator=OPERATOR&epochs=EPOCHS",
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := rejectPolicyFlag("serve"); err != nil {
+			return err
+		}
+		return rejectSelfStakeFlags("serve")
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		epochCache = newRewardSharesCache(cacheSize)
+		s := newServer(maxConcurrent)
+		log.Printf("listening on %s", listenAddr)
+		log.Fatal(http.ListenAndServe(listenAddr,
+			http.TimeoutHandler(s, requestTimeout, "request timed out\n")))
+	},
+}
+
+func init() {
+	ServeCmd.Flags().StringVarP(&listenAddr, "listen", "l", ":8080",
+		"address to listen on")
+	ServeCmd.Flags().DurationVarP(&requestTimeout, "timeout", "t", 5*time.Minute,
+		"timeout of a single request")
+	ServeCmd.Flags().IntVarP(&maxConcurrent, "max-concurrent", "c", 4,
+		"maximum number of requests computed concurrently")
+	ServeCmd.Flags().IntVar(&cacheSize, "cache-size", 1000,
+		"number of completed epochs kept in the cache")
+
+	PayoutCmd.AddCommand(ServeCmd)
+}
+
+// HTTP server exposing reward shares
+type server struct {
+	mux *http.ServeMux
+	// one token per request being computed
+	slots chan struct{}
+}
+
+func newServer(concurrency int) *server {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	s := &server{
+		mux:   http.NewServeMux(),
+		slots: make(chan struct{}, concurrency),
+	}
+	s.mux.HandleFunc("/delegates/", s.handleDelegateShares)
+	s.mux.HandleFunc("/voters/", s.handleVoterRewards)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// wait for a free slot, give up if the client goes away first
+	select {
+	case s.slots <- struct{}{}:
+	case <-r.Context().Done():
+		http.Error(w, "server busy", http.StatusServiceUnavailable)
+		return
+	}
+	defer func() { <-s.slots }()
+
+	// chain queries panic on failure, report them as server errors. The
+	// request context is passed down to them, so that they are cancelled
+	// when the client goes away or the request times out.
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			http.Error(w, fmt.Sprint(err), http.StatusInternalServerError)
+		}
+	}()
+	s.mux.ServeHTTP(w, r)
+}
+
+// GET /delegates/DELEGATE_NAME/epochs/EPOCHS/shares?operator=OPERATOR
+func (s *server) handleDelegateShares(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 5 || parts[2] != "epochs" || parts[4] != "shares" {
+		http.NotFound(w, r)
+		return
+	}
+	operator, err := alias.Address(r.URL.Query().Get("operator"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rs, err := calculateRewardShares(r.Context(), operator, delegateName(parts[1]), parts[3], defaultCommission())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRewardShares(w, rs)
+}
+
+// GET /voters/ADDRESS/rewards?delegate=DELEGATE_NAME&operator=OPERATOR&epochs=EPOCHS
+func (s *server) handleVoterRewards(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[2] != "rewards" {
+		http.NotFound(w, r)
+		return
+	}
+	voter, err := voterETHAddr(parts[1])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	operator, err := alias.Address(query.Get("operator"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delegate := query.Get("delegate")
+	if delegate == "" {
+		http.Error(w, "missing delegate", http.StatusBadRequest)
+		return
+	}
+
+	rs, err := calculateRewardShares(r.Context(), operator, delegateName(delegate), query.Get("epochs"), defaultCommission())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeRewardShares(w, rs.FilterVoter(voter))
+}
+
+func writeRewardShares(w http.ResponseWriter, rs *RewardShares) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, rs.String())
+}
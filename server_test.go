@@ -0,0 +1,94 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100)})
+	defer stop()
+	defer func(c *rewardSharesCache) { epochCache = c }(epochCache)
+	epochCache = newRewardSharesCache(10)
+
+	rs := combineRewardShares(context.Background(), testOperator, delegateName("delegate1"),
+		"10-11", []uint64{10, 11}, defaultCommission())
+	voter, _ := voterETHAddr("0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c")
+	tests := []struct {
+		method string
+		url    string
+		code   int
+		body   string
+	}{
+		{"GET", "/delegates/delegate1/epochs/10-11/shares?operator=" + testOperator,
+			http.StatusOK, rs.String() + "\n"},
+		{"GET", "/voters/0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c/rewards?delegate=delegate1&operator=" +
+			testOperator + "&epochs=10-11", http.StatusOK, rs.FilterVoter(voter).String() + "\n"},
+		{"GET", "/delegates/delegate1/epochs/11-10/shares?operator=" + testOperator,
+			http.StatusBadRequest, ""},
+		{"GET", "/delegates/delegate1/epochs/10-99/shares?operator=" + testOperator,
+			http.StatusBadRequest, ""},
+		{"GET", "/voters/0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c/rewards?delegate=delegate1&operator=" +
+			testOperator + "&epochs=last:0", http.StatusBadRequest, ""},
+		{"GET", "/voters/0xinvalid/rewards?delegate=delegate1&operator=" + testOperator,
+			http.StatusBadRequest, ""},
+		{"GET", "/voters/0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c/rewards?operator=" + testOperator,
+			http.StatusBadRequest, ""},
+		{"GET", "/delegates/delegate1/shares", http.StatusNotFound, ""},
+		{"POST", "/delegates/delegate1/epochs/10-11/shares", http.StatusMethodNotAllowed, ""},
+	}
+	s := newServer(1)
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(test.method, test.url, nil))
+		if w.Code != test.code {
+			t.Errorf("%s %s: expect status %d, get %d: %s", test.method, test.url, test.code, w.Code, w.Body)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s: expect %s, get %s", test.method, test.url, test.body, w.Body)
+		}
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	api := testAPIServer()
+	api.delay = time.Minute
+	stop := startFakeAPIServer(t, api, nil)
+	defer stop()
+
+	s := newServer(1)
+	h := http.TimeoutHandler(s, 50*time.Millisecond, "request timed out\n")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/delegates/delegate1/epochs/10/shares?operator="+testOperator, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expect the request to time out, get status %d", w.Code)
+	}
+
+	// the calls of the timed out request are cancelled and its slot freed
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s.slots) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expect the slot of the timed out request to be freed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
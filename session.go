@@ -0,0 +1,181 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-election/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// Connections to the chains shared by a whole run, the daemon or the server.
+//
+// The gRPC connection to the IoTeX API is checked before each use and
+// replaced when broken, failing over to the next endpoint. Every call goes
+// through the current connection, also those of clients created before it
+// was replaced, and a replaced connection is only closed once no call uses
+// it anymore. Calls are rate
+// limited and retried with backoff, see resilience.go. Votes are fetched from
+// the gravity chain APIs through committees keeping the results they fetched.
+// Epoch metas and votes are cached by epochMetas and voteSnapshots.
+type apiSession struct {
+	mu      sync.Mutex
+	conn    *grpc.ClientConn
+	gravity []*gravityEndpoint
+	// number of calls using each connection
+	inUse map[*grpc.ClientConn]int
+}
+
+// session of the current process
+var session = &apiSession{inUse: make(map[*grpc.ClientConn]int)}
+
+// dial the first reachable endpoint, with calls going through the session
+func (s *apiSession) dial() (*grpc.ClientConn, error) {
+	return connectToEndpoint(grpc.WithUnaryInterceptor(s.invoke))
+}
+
+// whether a connection can still be used
+func healthy(conn *grpc.ClientConn) bool {
+	state := conn.GetState()
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+// client of the IoTeX API, connecting or reconnecting if needed
+func (s *apiSession) client() (iotexapi.APIServiceClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && !healthy(s.conn) {
+		s.retire(s.conn)
+	}
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	}
+	return iotexapi.NewAPIServiceClient(s.conn), nil
+}
+
+// stop using the current connection, closed now if no call uses it or by
+// the last call using it. Called with s.mu held.
+func (s *apiSession) retire(conn *grpc.ClientConn) {
+	if s.conn == conn {
+		s.conn = nil
+	}
+	if s.inUse[conn] == 0 {
+		conn.Close()
+	}
+}
+
+// replace a broken connection, unless another call already did
+func (s *apiSession) reconnect(broken *grpc.ClientConn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn != broken && healthy(s.conn) {
+		return nil
+	}
+	if s.conn != nil {
+		s.retire(s.conn)
+	}
+	conn, err := s.dial()
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	s.conn = conn
+	return nil
+}
+
+// connection for an attempt of a call made through cc, the current one if cc
+// was replaced. It is not closed until released.
+func (s *apiSession) acquire(cc *grpc.ClientConn) *grpc.ClientConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conn := cc
+	if s.conn != nil {
+		conn = s.conn
+	}
+	s.inUse[conn]++
+	return conn
+}
+
+// release a connection, closing it if it was replaced and no call uses it
+func (s *apiSession) release(conn *grpc.ClientConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inUse[conn]--
+	if s.inUse[conn] > 0 {
+		return
+	}
+	delete(s.inUse, conn)
+	if conn != s.conn {
+		conn.Close()
+	}
+}
+
+// make a call within the rate limit of its endpoint, each attempt limited by
+// --api-timeout. A call failing because its endpoint is unavailable is made
+// again through a new connection, possibly to another endpoint.
+func (s *apiSession) invoke(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var broken *grpc.ClientConn
+	return retry(ctx, func() error {
+		if broken != nil {
+			if err := s.reconnect(broken); err != nil {
+				return err
+			}
+			broken = nil
+		}
+		conn := s.acquire(cc)
+		defer s.release(conn)
+		endpointLimiter(conn.Target()).wait()
+		attemptCtx, cancel := context.WithTimeout(ctx, apiTimeout)
+		defer cancel()
+		err := invoker(attemptCtx, method, req, reply, conn, opts...)
+		if status.Code(err) == codes.Unavailable {
+			broken = conn
+		}
+		return err
+	}, retryableCall)
+}
+
+// fetch the votes at a gravity chain height
+func (s *apiSession) electionResult(ctx context.Context, height uint64) (*types.ElectionResult, error) {
+	s.mu.Lock()
+	if s.gravity == nil {
+		s.gravity = newGravityEndpoints(CommitteeConfig.GravityChainAPIs)
+	}
+	eps := s.gravity
+	s.mu.Unlock()
+	return fetchElectionResult(ctx, eps, height)
+}
+
+// close the connection and forget the gravity chain APIs, the next call
+// connects again with the current flags
+func (s *apiSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	s.gravity = nil
+}
@@ -0,0 +1,347 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-election/committee"
+	"github.com/spf13/cobra"
+)
+
+// Files of a snapshot directory
+//   config.json      the delegates, epochs and settings of the run
+//   epochs/N.json    meta of epoch N
+//   votes/H.json     votes of all delegates at gravity chain height H
+//   output.json      the reward shares output
+//   multisend.json   the input for multisend
+//   manifest.json    SHA-256 of all the files above
+const (
+	snapshotConfigFile    = "config.json"
+	snapshotOutputFile    = "output.json"
+	snapshotMultisendFile = "multisend.json"
+	snapshotManifestFile  = "manifest.json"
+	snapshotEpochsDir     = "epochs"
+	snapshotVotesDir      = "votes"
+)
+
+// Flags
+var (
+	snapshotDir string
+)
+
+var VerifyCmd = &cobra.Command{
+	Use:   "verify SNAPSHOT_DIR",
+	Short: "Recalculates a payout offline from its snapshot and checks that the outputs match",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ok, err := verifySnapshot(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	PayoutCmd.Flags().StringVar(&snapshotDir, "snapshot", "",
+		"directory to save the inputs and outputs of the run, to verify it later")
+
+	PayoutCmd.AddCommand(VerifyCmd)
+}
+
+// Settings of a snapshotted run
+type SnapshotConfig struct {
+	Version string `json:"version"`
+	// whether the delegates come from a manifest
+	Manifest bool `json:"manifest"`
+	// delegates with resolved operator addresses
+	Delegates    []ManifestDelegate `json:"delegates"`
+	Epochs       string             `json:"epochs"`
+	EpochNums    []uint64           `json:"epochnums"`
+	Simple       bool               `json:"simple"`
+	Buckets      bool               `json:"buckets"`
+	Samples      int                `json:"samples"`
+	Policy       *Policy            `json:"policy,omitempty"`
+	Productivity ProductivityRules  `json:"productivity"`
+	Committee    committee.Config   `json:"committee"`
+}
+
+// Settings of the current run for the given delegates and epochs
+func newSnapshotConfig(delegates []ManifestDelegate, label string, epochNums []uint64) SnapshotConfig {
+	return SnapshotConfig{
+		Version:      version,
+		Delegates:    delegates,
+		Epochs:       label,
+		EpochNums:    epochNums,
+		Simple:       simpleJson,
+		Buckets:      bucketDetail,
+		Samples:      voteSamples,
+		Policy:       payoutPolicy,
+		Productivity: ProductivityRules{productivityThreshold},
+	}
+}
+
+// restore the settings of a snapshotted run
+func (c *SnapshotConfig) apply() error {
+	simpleJson = c.Simple
+	bucketDetail = c.Buckets
+	voteSamples = c.Samples
+	payoutPolicy = c.Policy
+	productivityThreshold = c.Productivity.Threshold
+	for _, d := range c.Delegates {
+		if err := setSelfStake(d.Name, d.SelfVoters, d.RedistributeSelfVotes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SHA-256 of the files of a snapshot
+type SnapshotManifest struct {
+	Version string            `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// Collects the chain data used by a run. A nil recorder records nothing.
+type snapshotRecorder struct {
+	mu     sync.Mutex
+	dir    string
+	epochs map[uint64]*iotexapi.GetEpochMetaResponse
+	votes  map[uint64]*VoteSnapshot
+}
+
+// recorder of the current run, nil if not snapshotting
+var recorder *snapshotRecorder
+
+// Allocate a recorder saving to dir, nil if dir is empty
+func newSnapshotRecorder(dir string) *snapshotRecorder {
+	if dir == "" {
+		return nil
+	}
+	return &snapshotRecorder{
+		dir:    dir,
+		epochs: make(map[uint64]*iotexapi.GetEpochMetaResponse),
+		votes:  make(map[uint64]*VoteSnapshot),
+	}
+}
+
+// record the chain data used to calculate an epoch
+func (r *snapshotRecorder) add(epoch *iotexapi.GetEpochMetaResponse, votes *VoteSnapshot) {
+	r.addEpoch(epoch)
+	r.addVotes(votes)
+}
+
+func (r *snapshotRecorder) addEpoch(epoch *iotexapi.GetEpochMetaResponse) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.epochs[epochNum(epoch)] = epoch
+}
+
+func (r *snapshotRecorder) addVotes(votes *VoteSnapshot) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.votes[votes.Height] = votes
+}
+
+// write the recorded data, the config and the outputs of the run
+func (r *snapshotRecorder) save(config SnapshotConfig, output string, sent string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config.Committee = CommitteeConfig
+
+	files := make(map[string][]byte)
+	files[snapshotConfigFile], _ = json.MarshalIndent(config, "", "    ")
+	files[snapshotOutputFile] = []byte(output)
+	files[snapshotMultisendFile] = []byte(sent)
+	marshaler := jsonpb.Marshaler{Indent: "    "}
+	for num, epoch := range r.epochs {
+		var buf bytes.Buffer
+		if err := marshaler.Marshal(&buf, epoch); err != nil {
+			return err
+		}
+		files[filepath.Join(snapshotEpochsDir, strconv.FormatUint(num, 10)+".json")] = buf.Bytes()
+	}
+	for height, votes := range r.votes {
+		files[filepath.Join(snapshotVotesDir, strconv.FormatUint(height, 10)+".json")], _ =
+			json.MarshalIndent(votes, "", "    ")
+	}
+
+	manifest := SnapshotManifest{version, make(map[string]string)}
+	for _, dir := range []string{snapshotEpochsDir, snapshotVotesDir} {
+		if err := os.MkdirAll(filepath.Join(r.dir, dir), 0755); err != nil {
+			return err
+		}
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(r.dir, name), data, 0644); err != nil {
+			return err
+		}
+		manifest.Files[filepath.ToSlash(name)] = sha256Hex(data)
+	}
+	data, _ := json.MarshalIndent(manifest, "", "    ")
+	return ioutil.WriteFile(filepath.Join(r.dir, snapshotManifestFile), data, 0644)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Loaded snapshot directory
+type snapshot struct {
+	config   SnapshotConfig
+	manifest SnapshotManifest
+	epochs   []*iotexapi.GetEpochMetaResponse
+	votes    []*VoteSnapshot
+}
+
+// read a snapshot directory, checking every file against the manifest
+func loadSnapshot(dir string) (*snapshot, []string, error) {
+	var s snapshot
+	data, err := ioutil.ReadFile(filepath.Join(dir, snapshotManifestFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(data, &s.manifest); err != nil {
+		return nil, nil, fmt.Errorf("invalid snapshot manifest: %v", err)
+	}
+
+	var mismatches []string
+	read := func(name string) ([]byte, error) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		if sha256Hex(data) != s.manifest.Files[name] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: SHA-256 does not match the manifest", name))
+		}
+		return data, nil
+	}
+
+	names := make([]string, 0, len(s.manifest.Files))
+	for name := range s.manifest.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := read(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case name == snapshotConfigFile:
+			err = json.Unmarshal(data, &s.config)
+		case filepath.Dir(filepath.FromSlash(name)) == snapshotEpochsDir:
+			epoch := &iotexapi.GetEpochMetaResponse{}
+			err = jsonpb.Unmarshal(bytes.NewReader(data), epoch)
+			s.epochs = append(s.epochs, epoch)
+		case filepath.Dir(filepath.FromSlash(name)) == snapshotVotesDir:
+			votes := &VoteSnapshot{}
+			err = json.Unmarshal(data, votes)
+			s.votes = append(s.votes, votes)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+	}
+	if len(s.config.Delegates) == 0 {
+		return nil, nil, fmt.Errorf("no delegate in snapshot %s", dir)
+	}
+	return &s, mismatches, nil
+}
+
+// recalculate the reward shares and the multisend input of a snapshot,
+// serving all chain data from it
+func (s *snapshot) replay() (string, string, error) {
+	offline = true
+	epochMetas = newMemo(len(s.epochs))
+	for _, epoch := range s.epochs {
+		epochMetas.put(epochNum(epoch), epoch)
+	}
+	voteSnapshots = newMemo(len(s.votes))
+	for _, votes := range s.votes {
+		voteSnapshots.put(votes.Height, votes)
+	}
+	if err := s.config.apply(); err != nil {
+		return "", "", err
+	}
+
+	if s.config.Manifest {
+		output, sent := payoutManifestEpochs(
+			&Manifest{s.config.Delegates}, s.config.Epochs, s.config.EpochNums)
+		return output, sent, nil
+	}
+	d := s.config.Delegates[0]
+	output, sent := payoutEpochs(
+		d.Name, d.Operator, s.config.Epochs, s.config.EpochNums, *d.Commission)
+	return output, sent, nil
+}
+
+// recalculate a snapshotted run offline, returns whether the outputs match
+func verifySnapshot(dir string) (bool, error) {
+	s, mismatches, err := loadSnapshot(dir)
+	if err != nil {
+		return false, err
+	}
+	if s.config.Version != version {
+		fmt.Printf("snapshot taken by version %s, verifying with version %s\n",
+			s.config.Version, version)
+	}
+
+	output, sent, err := s.replay()
+	if err != nil {
+		return false, err
+	}
+
+	if sha256Hex([]byte(output)) != s.manifest.Files[snapshotOutputFile] {
+		mismatches = append(mismatches, snapshotOutputFile+": recalculated reward shares differ")
+	}
+	if sha256Hex([]byte(sent)) != s.manifest.Files[snapshotMultisendFile] {
+		mismatches = append(mismatches, snapshotMultisendFile+": recalculated multisend input differs")
+	}
+	for _, m := range mismatches {
+		fmt.Println(m)
+	}
+	if len(mismatches) > 0 {
+		return false, nil
+	}
+	fmt.Printf("snapshot %s verified, %d files match\n", dir, len(s.manifest.Files))
+	return true, nil
+}
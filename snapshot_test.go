@@ -0,0 +1,146 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+	"github.com/iotexproject/iotex-core/protogen/iotextypes"
+)
+
+const (
+	testOperator      = "io1kfpsvefk74cqxd245j2h5t2pld2wtxzyg6tqrt"
+	testRewardAddress = "io1jh0ekmccywfkmj7e8qsuzsupnlk3w5337hjjg2"
+)
+
+// epoch meta where the test operator produced 15 blocks
+func testEpochMeta(num uint64, gravityHeight uint64) *iotexapi.GetEpochMetaResponse {
+	return &iotexapi.GetEpochMetaResponse{
+		EpochData: &iotextypes.EpochData{
+			Num:                     num,
+			Height:                  (num-1)*360 + 1,
+			GravityChainStartHeight: gravityHeight,
+		},
+		TotalBlocks: 15,
+		BlockProducersInfo: []*iotexapi.BlockProducerInfo{
+			{Address: testOperator, Votes: "3000000", Active: true, Production: 15},
+		},
+	}
+}
+
+// votes where delegate1 has two voters and delegate2 has one
+func testVoteSnapshot(height uint64) *VoteSnapshot {
+	iotx := func(n string) string { return n + "000000000000000000" }
+	bucket := func(voter string, amount string) Bucket {
+		return Bucket{voter, iotx(amount), iotx(amount),
+			time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC), "336h0m0s", true}
+	}
+	return &VoteSnapshot{
+		Height:   height,
+		MintTime: time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC),
+		Delegates: []SnapshotDelegate{{
+			Name:            hex.EncodeToString(delegateName("delegate1")),
+			OperatorAddress: testOperator,
+			RewardAddress:   testRewardAddress,
+			SelfStaking:     iotx("1200000"),
+			Score:           iotx("3000000"),
+			Votes: []Bucket{
+				bucket("45831656370acf0b345cc25558dc9b3b1424ddc3", "2000000"),
+				bucket("7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c", "1000000"),
+			},
+		}, {
+			Name:        hex.EncodeToString(delegateName("delegate2")),
+			SelfStaking: iotx("1200000"),
+			Score:       iotx("5000000"),
+			Votes: []Bucket{
+				bucket("7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c", "5000000"),
+			},
+		}},
+	}
+}
+
+// serve the given chain data offline, returns a function restoring the caches
+func useOfflineChainData(epochs []*iotexapi.GetEpochMetaResponse, votes []*VoteSnapshot) func() {
+	offlineOrig, epochMetasOrig, voteSnapshotsOrig := offline, epochMetas, voteSnapshots
+	offline = true
+	epochMetas = newMemo(len(epochs))
+	for _, epoch := range epochs {
+		epochMetas.put(epochNum(epoch), epoch)
+	}
+	voteSnapshots = newMemo(len(votes))
+	for _, vs := range votes {
+		voteSnapshots.put(vs.Height, vs)
+	}
+	return func() {
+		offline, epochMetas, voteSnapshots = offlineOrig, epochMetasOrig, voteSnapshotsOrig
+	}
+}
+
+func TestSnapshotVerify(t *testing.T) {
+	simpleJsonOrig := simpleJson
+	defer func() { simpleJson = simpleJsonOrig }()
+
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	restore := useOfflineChainData(
+		[]*iotexapi.GetEpochMetaResponse{testEpochMeta(10, 7500000), testEpochMeta(11, 7500100)},
+		[]*VoteSnapshot{testVoteSnapshot(7500000), testVoteSnapshot(7500100)})
+	comm := Commission{10, 10, 10}
+	epochs := []uint64{10, 11}
+	recorder = newSnapshotRecorder(dir)
+	output, sent := payoutEpochs("delegate1", testOperator, "10-11", epochs, comm)
+	err = recorder.save(newSnapshotConfig(
+		[]ManifestDelegate{{Name: "delegate1", Operator: testOperator, Commission: &comm}},
+		"10-11", epochs), output, sent)
+	recorder = nil
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verify reads all chain data from the snapshot
+	restore = useOfflineChainData(nil, nil)
+	defer restore()
+	ok, err := verifySnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("Expect snapshot to be verified")
+	}
+
+	// tampered output
+	path := filepath.Join(dir, snapshotMultisendFile)
+	if err := ioutil.WriteFile(path, []byte(sent+" "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ok, err = verifySnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("Expect tampered snapshot to fail verification")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iotexproject/iotex-address/address"
+	"github.com/iotexproject/iotex-core/cli/ioctl/cmd/alias"
+	"github.com/spf13/cobra"
+)
+
+// Flags
+var (
+	voterDelegates []string
+)
+
+var VoterCmd = &cobra.Command{
+	Use:   "voter ADDRESS -d DELEGATE_NAME:OPERATOR_[ALIAS|ADDRESS] [-d ...]",
+	Short: "Calculates a single voter's reward shares across delegates and epochs",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := rejectPolicyFlag("voter"); err != nil {
+			return err
+		}
+		return rejectSelfStakeFlags("voter")
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(voterDelegates) == 0 {
+			fmt.Println("at least one delegate is required")
+			os.Exit(2)
+		}
+		// per-epoch votes and shares are the point of this command
+		simpleJson = false
+
+		vr, err := voterRewards(args[0], voterDelegates, epochToQuery)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Println(vr.String())
+	},
+}
+
+func init() {
+	VoterCmd.Flags().StringSliceVarP(&voterDelegates, "delegate", "d", nil,
+		"delegate voted by the voter, in DELEGATE_NAME:OPERATOR format, can be repeated")
+	VoterCmd.Flags().StringVarP(&epochToQuery, "epoch", "e", "", epochRangeUsage)
+
+	PayoutCmd.AddCommand(VoterCmd)
+}
+
+// voter's reward in a single epoch
+type VoterEpochReward struct {
+	Epoch  uint64 `json:"epoch"`
+	Votes  string `json:"votes"`
+	Share  uint64 `json:"share"`
+	Reward Reward `json:"reward"`
+}
+
+// voter's rewards from a single delegate
+type VoterDelegateRewards struct {
+	Delegate string             `json:"delegate"`
+	Reward   Reward             `json:"reward"`
+	Epochs   []VoterEpochReward `json:"epochs"`
+}
+
+type VoterRewards struct {
+	IOAddr    string                 `json:"ioaddr"`
+	ETHAddr   string                 `json:"ethaddr"`
+	Reward    Reward                 `json:"reward"`
+	Delegates []VoterDelegateRewards `json:"delegates"`
+}
+
+// Debug string
+func (vr *VoterRewards) String() string {
+	vr_str, _ := json.MarshalIndent(vr, "", "    ")
+	return string(vr_str)
+}
+
+// calculate a voter's rewards from each of the delegates, delegates are given
+// as DELEGATE_NAME:OPERATOR
+func voterRewards(voter string, delegates []string, epochs string) (*VoterRewards, error) {
+	ethAddr, err := voterETHAddr(voter)
+	if err != nil {
+		return nil, err
+	}
+	ioAddr, err := address.FromBytes(common.HexToAddress(ethAddr).Bytes())
+	if err != nil {
+		return nil, err
+	}
+	vr := &VoterRewards{ioAddr.String(), ethAddr, Reward{"0", "0", "0"}, nil}
+
+	names := make([]string, len(delegates))
+	operators := make([]string, len(delegates))
+	delegateNames := make([][]byte, len(delegates))
+	for j, d := range delegates {
+		i := strings.LastIndex(d, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid delegate %s, expect DELEGATE_NAME:OPERATOR", d)
+		}
+		operators[j], err = alias.Address(d[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		names[j] = d[:i]
+		delegateNames[j] = delegateName(d[:i])
+	}
+	epochNums, err := resolveEpochs(context.Background(), epochs, delegateNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, name := range names {
+		dr := VoterDelegateRewards{Delegate: name, Reward: Reward{"0", "0", "0"}}
+		for _, epoch := range epochNums {
+			rs := cachedEpochRewardShares(context.Background(), operators[j], delegateNames[j], epoch,
+				defaultCommission()).FilterVoter(ethAddr)
+			if len(rs.Shares) == 0 {
+				continue
+			}
+			share := rs.Shares[0]
+			dr.Epochs = append(dr.Epochs, VoterEpochReward{
+				epoch, share.Votes[0], share.Share[0], share.Reward})
+			dr.Reward = addReward(dr.Reward, share.Reward)
+		}
+		vr.Reward = addReward(vr.Reward, dr.Reward)
+		vr.Delegates = append(vr.Delegates, dr)
+	}
+	return vr, nil
+}
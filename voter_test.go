@@ -0,0 +1,102 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/iotexproject/iotex-address/address"
+	"github.com/iotexproject/iotex-core/cli/ioctl/util"
+)
+
+func TestVoterRewards(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100)})
+	defer stop()
+	defer func(b, f, p int64) { blockComm, foundationComm, epochComm = b, f, p }(blockComm, foundationComm, epochComm)
+	blockComm, foundationComm, epochComm = 10, 10, 10
+
+	const (
+		voterA = "0x45831656370acf0b345cc25558dc9b3b1424ddc3"
+		voterB = "0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c"
+	)
+	ioAddrA, err := address.FromBytes(common.HexToAddress(voterA).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	delegate1 := "delegate1:" + testOperator
+	delegate2 := "delegate2:" + testRewardAddress
+	iotx := func(r Reward) [3]string {
+		return [3]string{util.RauToString(rau(r.Block), util.IotxDecimalNum),
+			util.RauToString(rau(r.FoundationBonus), util.IotxDecimalNum),
+			util.RauToString(rau(r.EpochBonus), util.IotxDecimalNum)}
+	}
+
+	tests := []struct {
+		voter     string
+		delegates []string
+		epochs    string
+		// total reward in IOTX and number of epochs voted for each delegate
+		reward      [3]string
+		epochsVoted []int
+	}{
+		// 2/3 of 90% of 240 IOTX block reward, 80 IOTX foundation bonus and
+		// 3/8 of 12500 IOTX epoch bonus, in each epoch
+		{voterA, []string{delegate1}, "10-11", [3]string{"288", "96", "5625"}, []int{2}},
+		{voterA, []string{delegate1}, "10", [3]string{"144", "48", "2812.5"}, []int{1}},
+		{ioAddrA.String(), []string{delegate1}, "11",
+			[3]string{"144", "48", "2812.5"}, []int{1}},
+		// 90% of 5/8 of the epoch bonus from delegate2, which produces no block
+		{voterB, []string{delegate1, delegate2}, "10", [3]string{"72", "24", "8437.5"}, []int{1, 1}},
+		// voterA does not vote for delegate2
+		{voterA, []string{delegate2}, "10-11", [3]string{"0", "0", "0"}, []int{0}},
+	}
+	for _, test := range tests {
+		vr, err := voterRewards(test.voter, test.delegates, test.epochs)
+		if err != nil {
+			t.Fatalf("%s %v: %v", test.voter, test.delegates, err)
+		}
+		if reward := iotx(vr.Reward); reward != test.reward {
+			t.Errorf("%s %v %s: expect reward %v, get %v", test.voter, test.delegates, test.epochs,
+				test.reward, reward)
+		}
+		if len(vr.Delegates) != len(test.epochsVoted) {
+			t.Fatalf("Expect %d delegates, get %d", len(test.epochsVoted), len(vr.Delegates))
+		}
+		for i, dr := range vr.Delegates {
+			if len(dr.Epochs) != test.epochsVoted[i] {
+				t.Errorf("%s %s: expect %d epochs, get %d", test.voter, dr.Delegate,
+					test.epochsVoted[i], len(dr.Epochs))
+			}
+		}
+	}
+
+	invalid := []struct {
+		voter     string
+		delegates []string
+		epochs    string
+	}{
+		{"0xinvalid", []string{delegate1}, "10"},
+		{voterA, []string{"delegate1"}, "10"},
+		{voterA, []string{"delegate1:unknown_alias"}, "10"},
+		{voterA, []string{delegate1}, "11-10"},
+	}
+	for _, test := range invalid {
+		if _, err := voterRewards(test.voter, test.delegates, test.epochs); err == nil {
+			t.Errorf("Expect error on %s %v %s", test.voter, test.delegates, test.epochs)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"time"
+
+	"github.com/iotexproject/iotex-election/types"
+)
+
+// A bucket of votes on the gravity chain
+type Bucket struct {
+	Voter          string    `json:"voter"`
+	Amount         string    `json:"amount"`
+	WeightedAmount string    `json:"weighted"`
+	StartTime      time.Time `json:"start"`
+	Duration       string    `json:"duration"`
+	Decay          bool      `json:"decay"`
+}
+
+// A delegate and the buckets voting for it
+type SnapshotDelegate struct {
+	Name            string   `json:"name"`
+	Address         string   `json:"address"`
+	OperatorAddress string   `json:"operator"`
+	RewardAddress   string   `json:"reward"`
+	SelfStaking     string   `json:"selfstaking"`
+	Score           string   `json:"score"`
+	Votes           []Bucket `json:"votes"`
+}
+
+// Votes of all delegates at a gravity chain height, in the order of the
+// election result
+type VoteSnapshot struct {
+	Height    uint64             `json:"height"`
+	MintTime  time.Time          `json:"minttime"`
+	Delegates []SnapshotDelegate `json:"delegates"`
+}
+
+// convert an election result fetched from the gravity chain
+func newVoteSnapshot(height uint64, result *types.ElectionResult) *VoteSnapshot {
+	vs := &VoteSnapshot{Height: height, MintTime: result.MintTime().UTC()}
+	for _, del := range result.Delegates() {
+		d := SnapshotDelegate{
+			Name:            hex.EncodeToString(del.Name()),
+			Address:         string(del.Address()),
+			OperatorAddress: string(del.OperatorAddress()),
+			RewardAddress:   string(del.RewardAddress()),
+			SelfStaking:     del.SelfStakingTokens().Text(10),
+			Score:           del.Score().Text(10),
+		}
+		for _, vote := range result.VotesByDelegate(del.Name()) {
+			d.Votes = append(d.Votes, Bucket{
+				Voter:          hex.EncodeToString(vote.Voter()),
+				Amount:         vote.Amount().Text(10),
+				WeightedAmount: vote.WeightedAmount().Text(10),
+				StartTime:      vote.StartTime().UTC(),
+				Duration:       vote.Duration().String(),
+				Decay:          vote.Decay(),
+			})
+		}
+		vs.Delegates = append(vs.Delegates, d)
+	}
+	return vs
+}
+
+// get the buckets voting for a delegate
+func (vs *VoteSnapshot) votesByDelegate(delegate []byte) []Bucket {
+	for i := range vs.Delegates {
+		if bytes.Equal(vs.Delegates[i].name(), delegate) {
+			return vs.Delegates[i].Votes
+		}
+	}
+	return nil
+}
+
+// get the delegates qualified as candidates, in the order of the election
+// result
+func (vs *VoteSnapshot) candidates() []*SnapshotDelegate {
+	robotVotes, _ := new(big.Int).SetString("100000000000000000000000000", 10)
+	smallRobotVotes, _ := new(big.Int).SetString("100000000000000000000", 10)
+	twoMillionVotes, _ := new(big.Int).SetString("2000000000000000000000000", 10)
+	selfVotes, _ := new(big.Int).SetString("1200000000000000000000000", 10)
+
+	var candidates []*SnapshotDelegate
+	for i := range vs.Delegates {
+		del := &vs.Delegates[i]
+		// delvote: total votes of the delegate
+		delvote := del.totalVotes()
+
+		// filter out large robot's votes
+		if delvote.Cmp(robotVotes) == 0 {
+			continue
+		}
+		// filter out small robot's votes
+		if delvote.Cmp(smallRobotVotes) == 0 {
+			continue
+		}
+		// filter out votes < 2,000,000
+		if delvote.Cmp(twoMillionVotes) < 0 {
+			continue
+		}
+		// filter out votes with self-votes < 1,200,000
+		if del.selfStaking().Cmp(selfVotes) < 0 {
+			continue
+		}
+		candidates = append(candidates, del)
+	}
+	return candidates
+}
+
+// get the buckets voting for a delegate, grouped by voter
+func (vs *VoteSnapshot) bucketsByVoter(delegate []byte) map[string][]Bucket {
+	buckets := make(map[string][]Bucket)
+	for _, bucket := range vs.votesByDelegate(delegate) {
+		buckets[bucket.Voter] = append(buckets[bucket.Voter], bucket)
+	}
+	return buckets
+}
+
+// get delegate's name as byte array
+func (d *SnapshotDelegate) name() []byte {
+	name, _ := hex.DecodeString(d.Name)
+	return name
+}
+
+// get total weighted votes of a delegate
+func (d *SnapshotDelegate) totalVotes() *big.Int {
+	total := new(big.Int)
+	for _, bucket := range d.Votes {
+		total.Add(total, bucket.weighted())
+	}
+	return total
+}
+
+func (d *SnapshotDelegate) selfStaking() *big.Int {
+	v, _ := new(big.Int).SetString(d.SelfStaking, 10)
+	return v
+}
+
+func (b *Bucket) weighted() *big.Int {
+	v, _ := new(big.Int).SetString(b.WeightedAmount, 10)
+	return v
+}
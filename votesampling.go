@@ -0,0 +1,98 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/iotexproject/iotex-core/protogen/iotexapi"
+)
+
+// get the meta of the epoch after the given one, nil if it has not started
+func nextEpochResponse(ctx context.Context, epoch_num uint64) *iotexapi.GetEpochMetaResponse {
+	if offline {
+		// a snapshot holds the next epoch if the run used it
+		if v := epochMetas.get(epoch_num + 1); v != nil {
+			return v.(*iotexapi.GetEpochMetaResponse)
+		}
+		return nil
+	}
+	if epoch_num+1 > latestEpoch(ctx) {
+		return nil
+	}
+	return getEpochResponse(ctx, epoch_num+1)
+}
+
+// average votes of each voter, sampled at several gravity chain heights
+// between the epoch's and the next epoch's
+func sampleVotes(ctx context.Context, delegate []byte, epoch_num uint64, start uint64) (map[string]*big.Int, *big.Int) {
+	end := start
+	if next := nextEpochResponse(ctx, epoch_num); next != nil {
+		recorder.addEpoch(next)
+		end = epochGravityHeight(next)
+	}
+
+	var samples []map[string]*big.Int
+	for _, height := range sampleHeights(start, end, CommitteeConfig.GravityChainHeightInterval, voteSamples) {
+		bps, _, _ := getVotes(ctx, delegate, height)
+		recorder.addVotes(fetchVoteSnapshot(ctx, height))
+		samples = append(samples, bps)
+	}
+	return averageVotes(samples)
+}
+
+// up to n heights evenly spread in [start, end), aligned to the interval
+// from start. Only start if the range is empty.
+func sampleHeights(start uint64, end uint64, interval uint64, n int) []uint64 {
+	heights := []uint64{start}
+	if end <= start || n <= 1 || interval == 0 {
+		return heights
+	}
+	for i := 1; i < n; i++ {
+		offset := (end - start) * uint64(i) / uint64(n)
+		height := start + offset/interval*interval
+		if height != heights[len(heights)-1] {
+			heights = append(heights, height)
+		}
+	}
+	return heights
+}
+
+// average votes of each voter over the samples, a voter missing from a
+// sample has no votes in it. Returns the averages and their total.
+func averageVotes(samples []map[string]*big.Int) (map[string]*big.Int, *big.Int) {
+	sums := make(map[string]*big.Int)
+	for _, bps := range samples {
+		for voter, votes := range bps {
+			if _, ok := sums[voter]; !ok {
+				sums[voter] = new(big.Int)
+			}
+			sums[voter].Add(sums[voter], votes)
+		}
+	}
+
+	n := big.NewInt(int64(len(samples)))
+	total := new(big.Int)
+	for voter, sum := range sums {
+		sum.Div(sum, n)
+		if sum.Sign() == 0 {
+			delete(sums, voter)
+			continue
+		}
+		total.Add(total, sum)
+	}
+	return sums, total
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestSampleHeights(t *testing.T) {
+	tests := []struct {
+		start, end uint64
+		n          int
+		expected   []uint64
+	}{
+		{7500000, 7500000, 4, []uint64{7500000}},
+		{7500000, 7500300, 1, []uint64{7500000}},
+		{7500000, 7500400, 4, []uint64{7500000, 7500100, 7500200, 7500300}},
+		// samples closer than the interval are merged
+		{7500000, 7500250, 4, []uint64{7500000, 7500100}},
+		{7500000, 7500300, 10, []uint64{7500000, 7500100, 7500200}},
+	}
+	for _, test := range tests {
+		heights := sampleHeights(test.start, test.end, 100, test.n)
+		if !reflect.DeepEqual(heights, test.expected) {
+			t.Errorf("Expect %v samples in [%d, %d) to be %v, get %v",
+				test.n, test.start, test.end, test.expected, heights)
+		}
+	}
+}
+
+func TestAverageVotes(t *testing.T) {
+	// voter b joins for the last of 4 samples
+	samples := []map[string]*big.Int{
+		{"a": big.NewInt(1000)},
+		{"a": big.NewInt(1000)},
+		{"a": big.NewInt(1000)},
+		{"a": big.NewInt(1000), "b": big.NewInt(3000)},
+	}
+	bps, total := averageVotes(samples)
+	if bps["a"].Int64() != 1000 || bps["b"].Int64() != 750 {
+		t.Fatalf("Expect average votes 1000 and 750, get %v and %v", bps["a"], bps["b"])
+	}
+	if total.Int64() != 1750 {
+		t.Fatalf("Expect total 1750, get %v", total)
+	}
+}
+
+func TestBucketsWithVoteSamples(t *testing.T) {
+	defer func(b bool, n int) { bucketDetail, voteSamples = b, n }(bucketDetail, voteSamples)
+	defer func(b, f, p int64) { blockComm, foundationComm, epochComm = b, f, p }(blockComm, foundationComm, epochComm)
+	blockComm, foundationComm, epochComm = 100, 100, 100
+
+	PayoutCmd.SetArgs([]string{"delegate1", "--buckets", "--vote-samples", "4"})
+	if err := PayoutCmd.Execute(); err == nil {
+		t.Error("Expect error on --buckets with --vote-samples 4")
+	}
+}
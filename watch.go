@@ -0,0 +1,301 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags
+var (
+	pollInterval     time.Duration
+	payoutEvery      uint64
+	payoutOutputFile string
+	stateFile        string
+	watchFrom        uint64
+)
+
+var WatchCmd = &cobra.Command{
+	Use:   "watch DELEGATE_NAME [OPERATOR_[ALIAS|ADDRESS]]",
+	Short: "Calculates voters' reward shares of every completed epoch, and pays out every N epochs",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		operator := ""
+		if len(args) > 1 {
+			operator = args[1]
+		}
+		operator, _, err := resolveDelegate(args[0], operator, rewardAddress, nil)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		policy, err := loadPolicy(policyFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if err := setSelfStake(args[0], selfVoters, redistributeSelfVotes); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		w := &watcher{
+			delegate: args[0],
+			operator: operator,
+			comm:     defaultCommission(),
+			policy:   policy,
+		}
+		if err := w.run(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	WatchCmd.Flags().DurationVarP(&pollInterval, "interval", "i", time.Minute,
+		"interval between two checks of the current epoch")
+	WatchCmd.Flags().Uint64VarP(&payoutEvery, "payout-every", "n", 0,
+		"pay out every N completed epochs, never by default")
+	WatchCmd.Flags().StringVar(&payoutOutputFile, "payout-output", "",
+		"file to output the multisend input of each payout to, suffixed with the epochs paid out, "+
+			"e.g. multisend-10-33.json, output to stdout by default")
+	WatchCmd.Flags().StringVar(&stateFile, "state", "iotex_payout.state",
+		"file keeping the progress, to resume after restart")
+	WatchCmd.Flags().Uint64Var(&watchFrom, "from", 0,
+		"first epoch to calculate when there is no state, the last completed epoch by default")
+	WatchCmd.Flags().StringVarP(&outputFile, "output", "o", "",
+		"file to output the reward shares of each epoch, output to stdout by default")
+
+	PayoutCmd.AddCommand(WatchCmd)
+}
+
+// Progress of the watcher, saved after every epoch
+type WatchState struct {
+	Delegate string `json:"delegate"`
+	// last epoch calculated
+	LastEpoch uint64 `json:"lastepoch"`
+	// epochs calculated but not paid out yet
+	UnpaidEpochs []uint64 `json:"unpaidepochs"`
+	// combined reward shares of the unpaid epochs
+	Unpaid *RewardShares `json:"unpaid"`
+	// payout taken out of the unpaid epochs but not output yet
+	Pending *WatchPayout `json:"pending,omitempty"`
+}
+
+// Multisend input paying out some epochs
+type WatchPayout struct {
+	Epochs    []uint64 `json:"epochs"`
+	Multisend string   `json:"multisend"`
+}
+
+type watcher struct {
+	delegate string
+	operator string
+	comm     Commission
+	policy   *Policy
+	state    WatchState
+	stop     chan os.Signal
+}
+
+// watch the chain until interrupted
+func (w *watcher) run() error {
+	if err := w.loadState(); err != nil {
+		return err
+	}
+
+	w.stop = make(chan os.Signal, 1)
+	signal.Notify(w.stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(w.stop)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if w.poll() {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case sig := <-w.stop:
+			log.Printf("received %v, stopping after epoch %d", sig, w.state.LastEpoch)
+			return nil
+		}
+	}
+	log.Printf("stopped after epoch %d", w.state.LastEpoch)
+	return nil
+}
+
+// calculate the epochs completed since last poll, returns whether to stop.
+// Failures are logged and retried at the next poll.
+func (w *watcher) poll() (stop bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("epoch %d: %v", w.state.LastEpoch+1, err)
+		}
+	}()
+
+	// a payout persisted before a crash is output first
+	if w.state.Pending != nil {
+		w.finishPayout()
+	}
+
+	current := currentEpochNum(context.Background())
+	if w.state.LastEpoch == 0 && current > 1 {
+		w.state.LastEpoch = current - 2
+		if watchFrom > 0 {
+			w.state.LastEpoch = watchFrom - 1
+		}
+	}
+	for epoch := w.state.LastEpoch + 1; epoch < current; epoch++ {
+		// stop between epochs, the state is consistent here
+		select {
+		case sig := <-w.stop:
+			log.Printf("received %v", sig)
+			return true
+		default:
+		}
+		w.calculate(epoch)
+	}
+	return false
+}
+
+// calculate a completed epoch and pay out if it is time to
+func (w *watcher) calculate(epoch uint64) {
+	log.Printf("epoch: %v", epoch)
+	rs := calculateEpochRewardShares(context.Background(), w.operator, delegateName(w.delegate), epoch, w.comm)
+	writeOutput(outputFile, rs.String())
+
+	if w.state.Unpaid == nil {
+		w.state.Unpaid = NewRewardShares()
+	}
+	w.state.Unpaid = w.state.Unpaid.Combine(rs)
+	w.state.UnpaidEpochs = append(w.state.UnpaidEpochs, epoch)
+	w.state.LastEpoch = epoch
+
+	if payoutEvery > 0 && uint64(len(w.state.UnpaidEpochs)) >= payoutEvery {
+		w.payout()
+		return
+	}
+	if err := w.saveState(); err != nil {
+		panic(err)
+	}
+}
+
+// pay out the unpaid epochs. The payout is saved in the state before it is
+// output, so that a restart outputs it again instead of paying the epochs
+// out twice.
+func (w *watcher) payout() {
+	epochs := w.state.UnpaidEpochs
+	log.Printf("paying out epochs %d-%d", epochs[0], epochs[len(epochs)-1])
+
+	s, _ := json.Marshal(multisend(voterPayouts(w.policy.apply(w.state.Unpaid.Clone()))))
+	w.state.Pending = &WatchPayout{epochs, string(s)}
+	w.state.UnpaidEpochs = nil
+	w.state.Unpaid = nil
+	if err := w.saveState(); err != nil {
+		panic(err)
+	}
+	w.finishPayout()
+}
+
+// output the pending payout to its own file, and to its own batch directory
+// with --batch-dir, then clear it from the state
+func (w *watcher) finishPayout() {
+	p := w.state.Pending
+	saveBatches(payoutFileName(filepath.Clean(batchDir), p.Epochs), p.Multisend,
+		completedPayoutRecords([]string{w.delegate}, p.Epochs))
+	if payoutOutputFile == "" {
+		fmt.Println(p.Multisend)
+	} else {
+		path := payoutFileName(payoutOutputFile, p.Epochs)
+		if err := writeFileAtomic(path, []byte(p.Multisend+"\n")); err != nil {
+			panic(err)
+		}
+		log.Printf("multisend input of epochs %d-%d written to %s",
+			p.Epochs[0], p.Epochs[len(p.Epochs)-1], path)
+	}
+	w.state.Pending = nil
+	if err := w.saveState(); err != nil {
+		panic(err)
+	}
+}
+
+// file of the payout of some epochs, e.g. multisend-10-33.json for
+// multisend.json
+func payoutFileName(path string, epochs []uint64) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d-%d%s", path[:len(path)-len(ext)], epochs[0], epochs[len(epochs)-1], ext)
+}
+
+func (w *watcher) loadState() error {
+	w.state = WatchState{Delegate: w.delegate}
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &w.state); err != nil {
+		return fmt.Errorf("invalid state file %s: %v", stateFile, err)
+	}
+	if w.state.Delegate != w.delegate {
+		return fmt.Errorf("state file %s belongs to delegate %s", stateFile, w.state.Delegate)
+	}
+	log.Printf("resuming after epoch %d, %d epochs unpaid",
+		w.state.LastEpoch, len(w.state.UnpaidEpochs))
+	if w.state.Pending != nil {
+		log.Printf("payout of epochs %v not output yet", w.state.Pending.Epochs)
+	}
+	return nil
+}
+
+func (w *watcher) saveState() error {
+	if w.state.Unpaid != nil && len(w.state.UnpaidEpochs) > 0 {
+		w.state.Unpaid.SetEpochNum(strconv.FormatUint(w.state.UnpaidEpochs[0], 10) +
+			"-" + strconv.FormatUint(w.state.LastEpoch, 10))
+	}
+	data, _ := json.MarshalIndent(w.state, "", "    ")
+	return writeFileAtomic(stateFile, data)
+}
+
+// write a file through a temporary file, so that it is never left half written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Infinity Stones
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPayoutFileName(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"multisend.json", "multisend-10-33.json"},
+		{"out/multisend", "out/multisend-10-33"},
+	}
+	for _, test := range tests {
+		if name := payoutFileName(test.path, []uint64{10, 20, 33}); name != test.expected {
+			t.Errorf("Expect %s, get %s", test.expected, name)
+		}
+	}
+}
+
+// watcher of delegate1 with its state and outputs in a temporary directory
+func testWatcher(t *testing.T) (*watcher, string, func()) {
+	dir, err := ioutil.TempDir("", "iotex_payout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateOrig, payoutOrig, everyOrig, fromOrig, outputOrig, recordOrig, batchOrig :=
+		stateFile, payoutOutputFile, payoutEvery, watchFrom, outputFile, recordFile, batchDir
+	stateFile = filepath.Join(dir, "state")
+	payoutOutputFile = filepath.Join(dir, "multisend.json")
+	outputFile = filepath.Join(dir, "shares.json")
+	recordFile, batchDir = "", ""
+	payoutEvery, watchFrom = 2, 10
+	w := &watcher{delegate: "delegate1", operator: testOperator, comm: Commission{10, 10, 10}}
+	return w, dir, func() {
+		stateFile, payoutOutputFile, payoutEvery, watchFrom, outputFile, recordFile, batchDir =
+			stateOrig, payoutOrig, everyOrig, fromOrig, outputOrig, recordOrig, batchOrig
+		os.RemoveAll(dir)
+	}
+}
+
+func TestWatchPayout(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), []*VoteSnapshot{
+		testVoteSnapshot(7500000), testVoteSnapshot(7500100)})
+	defer stop()
+	w, dir, restore := testWatcher(t)
+	defer restore()
+	batchDir = filepath.Join(dir, "batches")
+
+	if err := w.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	w.poll()
+
+	sent, err := ioutil.ReadFile(filepath.Join(dir, "multisend-10-11.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"recipient":"0x45831656370acf0b345cc25558dc9b3b1424ddc3","amount":"6009"},` +
+		`{"recipient":"0x7d5943b6ee8093be7dc75cd095ee12bfd6c8bf6c","amount":"3004.5"}]` + "\n"
+	if string(sent) != expected {
+		t.Errorf("Expect multisend input %s, get %s", expected, sent)
+	}
+	// along with its batches and the completed epochs to record
+	m, err := loadBatchManifest(filepath.Join(dir, "batches-10-11"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Recipients != 2 || m.Total != "9013.5" || len(m.Records) != 1 ||
+		m.Records[0].FirstEpoch != 10 || m.Records[0].LastEpoch != 11 {
+		t.Errorf("Unexpected batches of epochs 10-11 %+v", m)
+	}
+
+	// the state is saved with the epochs paid out
+	resumed := &watcher{delegate: "delegate1"}
+	if err := resumed.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.state.LastEpoch != 11 || resumed.state.Unpaid != nil || resumed.state.Pending != nil {
+		t.Errorf("Expect epochs up to 11 paid out, get %+v", resumed.state)
+	}
+}
+
+func TestWatchResumePendingPayout(t *testing.T) {
+	stop := startFakeAPIServer(t, testAPIServer(), nil)
+	defer stop()
+	w, dir, restore := testWatcher(t)
+	defer restore()
+
+	// crashed after saving the payout of epochs 10-11 but before writing it
+	w.state = WatchState{
+		Delegate:  "delegate1",
+		LastEpoch: 11,
+		Pending:   &WatchPayout{[]uint64{10, 11}, `[{"recipient":"0x01","amount":"1"}]`},
+	}
+	if err := w.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := &watcher{delegate: "delegate1", operator: testOperator}
+	if err := resumed.loadState(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resumed.state, w.state) {
+		t.Errorf("Expect state %+v, get %+v", w.state, resumed.state)
+	}
+	// epoch 11 is the last completed one, nothing is calculated again
+	resumed.poll()
+	sent, err := ioutil.ReadFile(filepath.Join(dir, "multisend-10-11.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sent) != `[{"recipient":"0x01","amount":"1"}]`+"\n" {
+		t.Errorf("Expect the pending payout to be written, get %s", sent)
+	}
+	if resumed.state.Pending != nil || resumed.state.LastEpoch != 11 {
+		t.Errorf("Expect the pending payout to be cleared, get %+v", resumed.state)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shares.json")); !os.IsNotExist(err) {
+		t.Error("Expect no epoch to be calculated again")
+	}
+}